@@ -0,0 +1,281 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrBlockLayout 块的开始、结束标记不在同一段落、同一表格或同一层级的段落中，或在同一段落中位于不同的元素 (如超链接) 中
+var ErrBlockLayout = errors.New("docx: block markers must share a paragraph, a table or a container")
+
+// block 模板中由一对标记包围的块，如 {{#if name}} ... {{/if}}
+type block struct {
+	openStart, openEnd   int // 开始标记位置
+	closeStart, closeEnd int // 结束标记位置
+}
+
+// blockTagReg 匹配 kind 类型块的开始或结束标记，开始标记的第一个子匹配为名称
+func (d *Docx) blockTagReg(kind string) *regexp.Regexp {
+	prefix := regexp.QuoteMeta(d.Config.PlaceholderPrefix)
+	suffix := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
+	return regexp.MustCompile(prefix + `(?:#` + kind + `\s+(.*?)|/` + kind + `)` + suffix)
+}
+
+// findBlock 从 from 开始查找名称为 name 的块，并按嵌套层级匹配对应的结束标记
+func (d *Docx) findBlock(content, kind, name string, from int) (block, bool, error) {
+	locs := d.blockTagReg(kind).FindAllStringSubmatchIndex(content[from:], -1)
+	for i, loc := range locs {
+		if loc[2] == -1 || strings.TrimSpace(content[from+loc[2]:from+loc[3]]) != name {
+			continue
+		}
+		depth := 0
+		for _, c := range locs[i+1:] {
+			if c[2] != -1 {
+				depth++
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			return block{
+				openStart:  from + loc[0],
+				openEnd:    from + loc[1],
+				closeStart: from + c[0],
+				closeEnd:   from + c[1],
+			}, true, nil
+		}
+		return block{}, false, fmt.Errorf("docx: block %s %q is not closed", kind, name)
+	}
+	return block{}, false, nil
+}
+
+/*
+blockRegion 计算块所影响的 XML 区间 [start, end) 以及去掉标记后的内部内容
+
+	开始、结束标记在同一段落: 仅处理两个标记之间的 run
+	开始、结束标记在同一表格行: 处理整行
+	开始、结束标记在同一表格的不同行: 处理两行之间 (含) 的所有行
+	其他情况: 处理两个段落之间 (含) 的所有内容，两个段落须位于同一单元格或同为正文
+*/
+func blockRegion(content string, b block) (start, end int, inner string, err error) {
+	ps, pe := findElement(content, b.openStart, "w:p")
+	pcs, pce := findElement(content, b.closeStart, "w:p")
+	if ps == pcs {
+		inner = content[b.openEnd:b.closeStart]
+		if !balancedInline(inner) {
+			return 0, 0, "", ErrBlockLayout
+		}
+		return b.openStart, b.closeEnd, inner, nil
+	}
+
+	rs, re := findElement(content, b.openStart, "w:tr")
+	rcs, rce := findElement(content, b.closeStart, "w:tr")
+	if rs != -1 && rs == rcs {
+		inner = content[rs:b.openStart] + content[b.openEnd:b.closeStart] + content[b.closeEnd:re]
+		return rs, re, inner, nil
+	}
+	if rs != -1 && rcs != -1 {
+		ts, _ := findElement(content, b.openStart, "w:tbl")
+		tcs, _ := findElement(content, b.closeStart, "w:tbl")
+		if ts == tcs {
+			inner = stripMarker(content[rs:re], b.openStart-rs, b.openEnd-rs) +
+				content[re:rcs] +
+				stripMarker(content[rcs:rce], b.closeStart-rcs, b.closeEnd-rcs)
+			return rs, rce, inner, nil
+		}
+	}
+
+	cs, _ := findElement(content, b.openStart, "w:tc")
+	ccs, _ := findElement(content, b.closeStart, "w:tc")
+	if ps == -1 || pcs == -1 || cs != ccs {
+		return 0, 0, "", ErrBlockLayout
+	}
+	inner = stripMarker(content[ps:pe], b.openStart-ps, b.openEnd-ps) +
+		content[pe:pcs] +
+		stripMarker(content[pcs:pce], b.closeStart-pcs, b.closeEnd-pcs)
+	return ps, pce, inner, nil
+}
+
+// xmlTagReg 匹配开始、结束或自闭合标签
+var xmlTagReg = regexp.MustCompile(`<(/?)([\w:.-]+)[^>]*?(/?)>`)
+
+// balancedInline 判断同一段落中两个标记之间的内容能否按字节区间删除或复制
+// 两个标记所在位置的祖先元素必须一致 (如都直接位于段落的 run 中)，否则删除后会留下不成对的标签
+func balancedInline(inner string) bool {
+	var opened, closed []string
+	for _, m := range xmlTagReg.FindAllStringSubmatch(inner, -1) {
+		switch {
+		case m[3] == "/":
+		case m[1] == "":
+			opened = append(opened, m[2])
+		case len(opened) > 0:
+			if opened[len(opened)-1] != m[2] {
+				return false
+			}
+			opened = opened[:len(opened)-1]
+		default:
+			closed = append(closed, m[2])
+		}
+	}
+	// 关闭的开始标记所在的元素 (由内向外) 须与重新打开的结束标记所在的元素 (由外向内) 一一对应
+	if len(opened) != len(closed) {
+		return false
+	}
+	for i, name := range opened {
+		if closed[len(closed)-1-i] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// stripMarker 去掉段落或行中的标记，若除标记外不含任何文本或图片则整体丢弃
+func stripMarker(unit string, markStart, markEnd int) string {
+	rest := unit[:markStart] + unit[markEnd:]
+	if strings.TrimSpace(stripTags(rest)) == "" && !strings.Contains(rest, "<w:drawing") && !strings.Contains(rest, "<w:pict") {
+		return ""
+	}
+	return rest
+}
+
+// expandBlock 将块替换为 n 份内部内容，f 不为 nil 时用于处理第 i 份内容
+// 返回新的内容以及块所在区间的起始位置，便于继续向后查找
+func expandBlock(content string, b block, n int, f func(inner string, i int) string) (string, int, error) {
+	start, end, inner, err := blockRegion(content, b)
+	if err != nil {
+		return content, 0, err
+	}
+	var sb strings.Builder
+	sb.WriteString(content[:start])
+	for i := 0; i < n; i++ {
+		if f != nil {
+			sb.WriteString(f(inner, i))
+		} else {
+			sb.WriteString(inner)
+		}
+	}
+	sb.WriteString(content[end:])
+	return sb.String(), start, nil
+}
+
+/*
+SetCondition 设置条件块
+
+	{{#if name}} ... {{/if}}
+
+value 为真值时保留块内容 (去掉标记)，否则删除整个块。
+bool 按其值判断，字符串、切片、map 按是否为空判断，其余类型按是否为零值判断。
+标记位于同一段落时删除的是其间的 run，位于不同段落或表格行时删除的是整段或整行。
+*/
+func (d *Docx) SetCondition(name string, value interface{}) error {
+	n := 0
+	if isTruthy(value) {
+		n = 1
+	}
+	return d.expandBlocks("if", name, n, nil)
+}
+
+// isTruthy 判断条件值是否成立
+func isTruthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return false
+		}
+		return isTruthy(rv.Elem().Interface())
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	}
+	return !rv.IsZero()
+}
+
+/*
+CloneBlock 复制循环块 n 次
+
+	{{#each name}} ... {{/each}}
+
+块内的占位符按复制的序号加上索引，与 CloneRow 一致:
+{{title}} 变为 {{title#0}}、{{title#1}} ...
+嵌套的循环块同样会加上索引，如 {{#each sub}} 变为 {{#each sub#0}}，
+可继续调用 CloneBlock("sub#0", m) 展开，其中的占位符变为 {{x#0#0}}、{{x#0#1}} ...
+n 为 0 时删除整个块。
+*/
+func (d *Docx) CloneBlock(name string, n int) error {
+	return d.expandBlocks("each", name, n, func(inner string, i int) string {
+		return indexVariables(d, inner, i)
+	})
+}
+
+/*
+SetEach 按 items 展开循环块，并以每一项的值填充对应副本中的占位符
+
+只替换块内名称与键完全相同的占位符，其余占位符与 CloneBlock 一样加上索引，
+不会影响块以外的内容。所有副本中都未匹配的键与 SetValue 一样记录为未使用的键
+*/
+func (d *Docx) SetEach(name string, items []map[string]string) error {
+	used := make(map[string]bool)
+	// 值先以占位文本写入副本，展开后在文档树中替换，换行的处理同 SetValue
+	var reps []replacement
+	var placeholders []string
+	err := d.expandBlocks("each", name, len(items), func(inner string, i int) string {
+		return fillIndexedVariables(d, inner, i, func(key string) (string, bool) {
+			v, ok := items[i][key]
+			if !ok {
+				return "", false
+			}
+			value, err := encode(v)
+			if err != nil {
+				return "", false
+			}
+			used[key] = true
+			search := valueToken(len(reps))
+			reps = append(reps, replacement{key: key, search: search, value: value})
+			placeholders = append(placeholders, d.Config.PlaceholderPrefix+key+"#"+strconv.Itoa(i)+d.Config.PlaceholderSuffix)
+			return search, true
+		})
+	})
+	if err == nil {
+		err = d.updateParts(func(partName, content string) (string, error) {
+			return fillTokens(partName, content, reps, placeholders)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		for key := range item {
+			n := 0
+			if used[key] {
+				n = 1
+			}
+			d.recordKey(key+"#"+strconv.Itoa(i), n)
+		}
+	}
+	return nil
+}
+
+// expandBlocks 在所有部件中依次展开名称为 name 的 kind 类型块，规则同 expandBlock
+func (d *Docx) expandBlocks(kind, name string, n int, f func(inner string, i int) string) error {
+	return d.updateParts(func(_, content string) (string, error) {
+		from := 0
+		for {
+			b, ok, err := d.findBlock(content, kind, name, from)
+			if err != nil || !ok {
+				return content, err
+			}
+			content, from, err = expandBlock(content, b, n, f)
+			if err != nil {
+				return content, err
+			}
+		}
+	})
+}
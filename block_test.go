@@ -0,0 +1,114 @@
+package docx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetCondition(t *testing.T) {
+	row := func(text string) string {
+		return `<w:tr><w:tc>` + testParagraph(text) + `</w:tc></w:tr>`
+	}
+	body := testParagraph(`a{{#if inline}}</w:t></w:r><w:r><w:t>b{{/if}}c`) +
+		testParagraph(`{{#if para</w:t></w:r><w:r><w:t>}}`) + testParagraph(`hidden`) + testParagraph(`{{/if}}`) +
+		`<w:tbl>` + row(`{{#if rows}}`) + row(`shown`) + row(`{{/if}}`) + `</w:tbl>`
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	for name, value := range map[string]interface{}{"inline": "", "para": false, "rows": []int{1}} {
+		if err := doc.SetCondition(name, value); err != nil {
+			t.Fatalf("设置条件 %s 失败: %v", name, err)
+		}
+	}
+
+	want := testParagraph(`ac`) + `<w:tbl>` + row(`shown`) + `</w:tbl>`
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("条件块处理结果错误: %s", doc.MainPart)
+	}
+}
+
+func TestSetConditionNotClosed(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{#if x}}`))
+	defer doc.Close()
+
+	if err := doc.SetCondition("x", true); err == nil {
+		t.Error("未闭合的条件块应返回错误")
+	}
+}
+
+func TestSetConditionAcrossElements(t *testing.T) {
+	body := `<w:p><w:r><w:t>a{{#if x}}</w:t></w:r><w:hyperlink><w:r><w:t>link{{/if}}</w:t></w:r></w:hyperlink></w:p>`
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.SetCondition("x", false); !errors.Is(err, ErrBlockLayout) {
+		t.Errorf("标记所在的元素不同时应返回 ErrBlockLayout: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, body) {
+		t.Errorf("返回错误时不应修改内容: %s", doc.MainPart)
+	}
+}
+
+func TestCloneBlock(t *testing.T) {
+	body := testParagraph(`{{#each items}}`) +
+		testParagraph(`{{title}}`) +
+		testParagraph(`{{#each tags}}[{{tag}}]{{/each}}`) +
+		testParagraph(`{{/each}}`)
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.CloneBlock("items", 2); err != nil {
+		t.Fatalf("复制块失败: %v", err)
+	}
+	if err := doc.SetEach("tags#1", []map[string]string{{"tag#1": "a"}, {"tag#1": "b"}}); err != nil {
+		t.Fatalf("展开嵌套块失败: %v", err)
+	}
+
+	want := testParagraph(`{{title#0}}`) +
+		testParagraph(`{{#each tags#0}}[{{tag#0}}]{{/each}}`) +
+		testParagraph(`{{title#1}}`) +
+		testParagraph(`[a][b]`)
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("循环块处理结果错误: %s", doc.MainPart)
+	}
+}
+
+func TestSetEachScope(t *testing.T) {
+	body := testParagraph(`{{a#0}}`) +
+		testParagraph(`{{#each items}}`) +
+		testParagraph(`{{a}}-{{ab}}-{{b}}`) +
+		testParagraph(`{{/each}}`)
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.SetEach("items", []map[string]string{{"a": "1", "ab": "2"}}); err != nil {
+		t.Fatalf("展开块失败: %v", err)
+	}
+	want := testParagraph(`{{a#0}}`) + testParagraph(`1-2-{{b#0}}`)
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("只应替换块内完全匹配的占位符: %s", doc.MainPart)
+	}
+}
+
+func TestSetEachMultilineValue(t *testing.T) {
+	body := testParagraph(`{{#each items}}`) +
+		testParagraph(`{{note}}`) + `<w:p><w:fldSimple w:instr="{{note}}"/></w:p>` +
+		testParagraph(`{{/each}}`)
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.SetEach("items", []map[string]string{{"note": "x\r\ny"}}); err != nil {
+		t.Fatalf("展开块失败: %v", err)
+	}
+	want := `<w:t xml:space="preserve">x</w:t><w:br/><w:t xml:space="preserve">y</w:t>`
+	if !strings.Contains(doc.MainPart, want) || !strings.Contains(doc.MainPart, `w:instr="{{note#0}}"`) {
+		t.Errorf("换行应拆分为 w:br，属性值中的占位符应加上索引: %s", doc.MainPart)
+	}
+	if strings.Contains(doc.MainPart, "\x01") {
+		t.Errorf("不应残留占位文本: %q", doc.MainPart)
+	}
+}
@@ -0,0 +1,518 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tcPrOrder w:tcPr 子元素在 schema 中的顺序
+var tcPrOrder = []string{
+	"w:cnfStyle", "w:tcW", "w:gridSpan", "w:hMerge", "w:vMerge", "w:tcBorders", "w:shd",
+	"w:noWrap", "w:tcMar", "w:textDirection", "w:tcFitText", "w:vAlign", "w:hideMark",
+}
+
+var (
+	gridSpanReg = regexp.MustCompile(`<w:gridSpan w:val="(\d+)"\s*/>`)
+	widthReg    = regexp.MustCompile(`w:w="(\d+)"`)
+	gridColReg  = regexp.MustCompile(`<w:gridCol\b[^>]*/>`)
+)
+
+// tableCell 表格行中的单元格
+type tableCell struct {
+	start, end int // 在行中的位置 [start, end)
+	col, span  int // 起始网格列与跨列数
+}
+
+// rowCells 解析行中的单元格，不包含嵌套表格中的单元格
+func rowCells(row string) []tableCell {
+	var cells []tableCell
+	col := 0
+	for _, r := range findElements(row, "w:tc") {
+		span := cellSpan(row[r[0]:r[1]])
+		cells = append(cells, tableCell{start: r[0], end: r[1], col: col, span: span})
+		col += span
+	}
+	return cells
+}
+
+// cellAt 返回覆盖网格列 col 的单元格
+func cellAt(cells []tableCell, col int) (tableCell, bool) {
+	for _, c := range cells {
+		if c.col <= col && col < c.col+c.span {
+			return c, true
+		}
+	}
+	return tableCell{}, false
+}
+
+// cellProps 单元格属性 w:tcPr 的位置 [start, end)，不存在时 start == end 为应插入的位置
+func cellProps(cell string) (start, end int) {
+	gt := strings.IndexByte(cell, '>') + 1
+	if isOpenTag(cell, gt, "w:tcPr") {
+		return findElement(cell, gt, "w:tcPr")
+	}
+	return gt, gt
+}
+
+// cellSpan 单元格跨越的网格列数
+func cellSpan(cell string) int {
+	start, end := cellProps(cell)
+	if m := gridSpanReg.FindStringSubmatch(cell[start:end]); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// cellWidth 单元格 w:tcW 的宽度，未设置时返回 -1
+func cellWidth(cell string) int {
+	start, end := cellProps(cell)
+	props := cell[start:end]
+	if i := strings.Index(props, `<w:tcW `); i != -1 {
+		if m := widthReg.FindStringSubmatch(props[i:]); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return -1
+}
+
+// setCellProp 设置单元格属性 name (如 w:gridSpan)，xml 为空时删除该属性
+// 新属性按 schema 顺序插入 w:tcPr，w:tcPr 不存在时自动创建
+func setCellProp(cell, name, xml string) string {
+	start, end := cellProps(cell)
+	if start == end {
+		if xml == "" {
+			return cell
+		}
+		return StringBuilder(cell[:start], `<w:tcPr>`, xml, `</w:tcPr>`, cell[start:])
+	}
+
+	props := cell[start:end]
+	if i := strings.Index(props, "<"+name); i != -1 && isOpenTag(props, i, name) {
+		e := strings.IndexByte(props[i:], '>') + i + 1
+		if props[e-2] != '/' {
+			_, e = findElement(props, i, name)
+		}
+		props = props[:i] + props[e:]
+	}
+	if xml != "" {
+		pos := len(props) - len(`</w:tcPr>`)
+		rank := len(tcPrOrder)
+		for r, n := range tcPrOrder {
+			if n == name {
+				rank = r
+			}
+		}
+		for r := rank + 1; r < len(tcPrOrder); r++ {
+			n := tcPrOrder[r]
+			if i := strings.Index(props, "<"+n); i != -1 && isOpenTag(props, i, n) && i < pos {
+				pos = i
+			}
+		}
+		props = props[:pos] + xml + props[pos:]
+	}
+	return cell[:start] + props + cell[end:]
+}
+
+// setCellWidth 设置单元格宽度，保留原有的宽度类型
+func setCellWidth(cell string, width int) string {
+	start, end := cellProps(cell)
+	props := cell[start:end]
+	i := strings.Index(props, `<w:tcW `)
+	if i == -1 {
+		return setCellProp(cell, "w:tcW", `<w:tcW w:w="`+strconv.Itoa(width)+`" w:type="dxa"/>`)
+	}
+	e := strings.IndexByte(props[i:], '>') + i + 1
+	tcW := widthReg.ReplaceAllString(props[i:e], `w:w="`+strconv.Itoa(width)+`"`)
+	return cell[:start] + props[:i] + tcW + props[e:] + cell[end:]
+}
+
+/*
+CloneColumn 复制标记所在单元格的整列 n 次 (标记 列数)
+
+表格的每一行中处于同一网格列的单元格都会被复制，副本中的占位符加上索引 #0 ... #n-1，
+该列在 w:tblGrid 中的宽度及单元格宽度平均分配给各个副本，表格总宽度保持不变；
+跨越该列的合并单元格 (w:gridSpan) 扩展为覆盖所有副本。n 为 0 时删除该列，
+删除后表格中已没有任何单元格时与 DeleteRow 一样删除整个表格。
+主体、页眉和页脚中所有包含标记的表格都会被处理。
+*/
+func (d *Docx) CloneColumn(mark string, n int) error {
+	mark = ensureMacroCompleted(d, mark)
+	if n < 0 {
+		return fmt.Errorf("docx: invalid column count %d", n)
+	}
+	found, cloned := false, 0
+	err := d.updateParts(func(_, content string) (string, error) {
+		from := 0
+		for {
+			pos := strings.Index(content[from:], mark)
+			if pos == -1 {
+				return content, nil
+			}
+			pos += from
+			found = true
+
+			cs, _ := findElement(content, pos, "w:tc")
+			if cs == -1 {
+				from = pos + len(mark)
+				continue
+			}
+			rs, re := findElement(content, cs, "w:tr")
+			ts, te := findElement(content, cs, "w:tbl")
+			col := -1
+			for _, c := range rowCells(content[rs:re]) {
+				if rs+c.start == cs {
+					col = c.col
+				}
+			}
+			tbl := cloneTableColumn(d, content[ts:te], col, n)
+			if !strings.Contains(tbl, "<w:tc") {
+				tbl = ""
+			}
+			content = replaceElement(content, ts, te, tbl)
+			from = ts + len(tbl)
+			cloned++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, mark)
+	}
+	if cloned == 0 {
+		return fmt.Errorf("%w: %s", ErrNotInTable, mark)
+	}
+	return nil
+}
+
+// cloneTableColumn 复制表格的第 col 列 n 次
+func cloneTableColumn(d *Docx, tbl string, col, n int) string {
+	var sb strings.Builder
+	last := 0
+
+	// 网格列宽，widths 为复制后各网格列的宽度，未设置宽度时为 -1
+	var widths []int
+	if gs, ge := findElement(tbl, strings.Index(tbl, "<w:tblGrid"), "w:tblGrid"); gs != -1 {
+		cols := gridColReg.FindAllStringIndex(tbl[gs:ge], -1)
+		for i, c := range cols {
+			w := -1
+			if m := widthReg.FindStringSubmatch(tbl[gs+c[0] : gs+c[1]]); m != nil {
+				w, _ = strconv.Atoi(m[1])
+			}
+			if i != col {
+				widths = append(widths, w)
+				continue
+			}
+			for k := 0; k < n; k++ {
+				if w > 0 {
+					widths = append(widths, w/n)
+				} else {
+					widths = append(widths, w)
+				}
+			}
+		}
+		if col < len(cols) {
+			gridCol := tbl[gs+cols[col][0] : gs+cols[col][1]]
+			sb.WriteString(tbl[:gs+cols[col][0]])
+			for i := 0; i < n; i++ {
+				if m := widthReg.FindStringSubmatch(gridCol); m != nil {
+					w, _ := strconv.Atoi(m[1])
+					sb.WriteString(widthReg.ReplaceAllString(gridCol, `w:w="`+strconv.Itoa(w/n)+`"`))
+				} else {
+					sb.WriteString(gridCol)
+				}
+			}
+			last = gs + cols[col][1]
+		}
+	}
+
+	// 每一行中对应的单元格
+	for _, r := range findElements(tbl, "w:tr") {
+		if r[0] < last {
+			continue
+		}
+		row := tbl[r[0]:r[1]]
+		c, ok := cellAt(rowCells(row), col)
+		if !ok {
+			continue
+		}
+		sb.WriteString(tbl[last : r[0]+c.start])
+		cell := row[c.start:c.end]
+		if c.span > 1 {
+			span := c.span + n - 1
+			if span == 1 {
+				cell = setCellProp(cell, "w:gridSpan", "")
+			} else {
+				cell = setCellProp(cell, "w:gridSpan", `<w:gridSpan w:val="`+strconv.Itoa(span)+`"/>`)
+			}
+			// 合并单元格的宽度为其覆盖的网格列宽度之和
+			if w := gridWidth(widths, c.col, span); w > 0 && cellWidth(cell) > 0 {
+				cell = setCellWidth(cell, w)
+			}
+			sb.WriteString(cell)
+		} else {
+			w := cellWidth(cell)
+			for i := 0; i < n; i++ {
+				clone := indexVariables(d, cell, i)
+				if w > 0 {
+					clone = setCellWidth(clone, w/n)
+				}
+				sb.WriteString(clone)
+			}
+		}
+		last = r[0] + c.end
+	}
+	sb.WriteString(tbl[last:])
+	return sb.String()
+}
+
+// gridWidth 返回从网格列 col 开始的 span 列的宽度之和，有列未设置宽度或越界时返回 -1
+func gridWidth(widths []int, col, span int) int {
+	if col < 0 || col+span > len(widths) {
+		return -1
+	}
+	total := 0
+	for _, w := range widths[col : col+span] {
+		if w <= 0 {
+			return -1
+		}
+		total += w
+	}
+	return total
+}
+
+// ErrCellRange 合并单元格时行列超出表格范围或与已有的合并单元格边界不一致
+var ErrCellRange = errors.New("docx: cell range does not match the table layout")
+
+// MergeCellsHorizontal 横向合并 (w:gridSpan) 表格第 row 行中网格列 [fromCol, toCol] 的单元格，行列均从 0 开始
+// mark 为表格中的占位符 (如表头中的占位符)，合并须在该占位符被填充之前进行
+// 被合并单元格中的非空段落会追加到第一个单元格中
+func (d *Docx) MergeCellsHorizontal(mark string, row, fromCol, toCol int) error {
+	return d.updateTables(mark, func(tbl string) (string, error) {
+		return mergeHorizontal(tbl, row, fromCol, toCol)
+	})
+}
+
+// MergeCellsVertical 纵向合并 (w:vMerge) 表格第 col 列中 [fromRow, toRow] 行的单元格，表格的定位同 MergeCellsHorizontal
+// 被合并单元格中的非空段落会追加到第一个单元格中
+func (d *Docx) MergeCellsVertical(mark string, col, fromRow, toRow int) error {
+	return d.updateTables(mark, func(tbl string) (string, error) {
+		return mergeVertical(tbl, col, fromRow, toRow, true)
+	})
+}
+
+// AutoMergeColumn 纵向合并表格第 col 列中连续且文本相同的单元格，通常在 CloneRow/SetTableRows 填充之后调用
+// 表格的定位同 MergeCellsHorizontal，表头行 (w:tblHeader) 不参与合并
+func (d *Docx) AutoMergeColumn(mark string, col int) error {
+	return d.updateTables(mark, func(tbl string) (string, error) {
+		var err error
+		for from := 0; ; {
+			texts := columnTexts(tbl, col)
+			if from >= len(texts) {
+				return tbl, nil
+			}
+			to := from
+			for to+1 < len(texts) && texts[from] != "" && texts[to+1] == texts[from] {
+				to++
+			}
+			if to > from {
+				if tbl, err = mergeVertical(tbl, col, from, to, false); err != nil {
+					return tbl, err
+				}
+			}
+			from = to + 1
+		}
+	})
+}
+
+// updateTables 对所有部件中包含占位符 mark 的表格 (嵌套时为最内层) 执行 f
+// mark 不存在时返回 ErrPlaceholderNotFound，不在任何表格中时返回 ErrNotInTable
+func (d *Docx) updateTables(mark string, f func(tbl string) (string, error)) error {
+	search := ensureMacroCompleted(d, mark)
+	found, updated := false, 0
+	err := d.updateParts(func(_, content string) (string, error) {
+		from := 0
+		for {
+			pos := strings.Index(content[from:], search)
+			if pos == -1 {
+				return content, nil
+			}
+			pos += from
+			// 跳过标签内部 (属性值) 的匹配
+			if strings.LastIndexByte(content[:pos], '<') > strings.LastIndexByte(content[:pos], '>') {
+				from = pos + len(search)
+				continue
+			}
+			found = true
+
+			ts, te := findElement(content, pos, "w:tbl")
+			if ts == -1 {
+				from = pos + len(search)
+				continue
+			}
+			tbl, err := f(content[ts:te])
+			if err != nil {
+				return content, err
+			}
+			content = StringBuilder(content[:ts], tbl, content[te:])
+			from = ts + len(tbl)
+			updated++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, mark)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: %s", ErrNotInTable, mark)
+	}
+	return nil
+}
+
+// mergeHorizontal 合并第 row 行中网格列 [fromCol, toCol] 的单元格
+func mergeHorizontal(tbl string, row, fromCol, toCol int) (string, error) {
+	rows := findElements(tbl, "w:tr")
+	if row < 0 || row >= len(rows) || fromCol < 0 || fromCol >= toCol {
+		return tbl, ErrCellRange
+	}
+	r := tbl[rows[row][0]:rows[row][1]]
+	cells := rowCells(r)
+	first, ok1 := cellAt(cells, fromCol)
+	last, ok2 := cellAt(cells, toCol)
+	if !ok1 || !ok2 || first.col != fromCol || last.col+last.span-1 != toCol {
+		return tbl, ErrCellRange
+	}
+
+	var extra strings.Builder
+	width := 0
+	for _, c := range cells {
+		if c.start < first.start || c.start > last.start {
+			continue
+		}
+		cell := r[c.start:c.end]
+		if w := cellWidth(cell); w > 0 && width >= 0 {
+			width += w
+		} else {
+			width = -1
+		}
+		if c.start != first.start {
+			extra.WriteString(cellContent(cell))
+		}
+	}
+
+	merged := r[first.start:first.end]
+	merged = setCellProp(merged, "w:gridSpan", `<w:gridSpan w:val="`+strconv.Itoa(toCol-fromCol+1)+`"/>`)
+	if width > 0 {
+		merged = setCellWidth(merged, width)
+	}
+	merged = appendCellContent(merged, extra.String())
+
+	start, end := rows[row][0]+first.start, rows[row][0]+last.end
+	return StringBuilder(tbl[:start], merged, tbl[end:]), nil
+}
+
+// mergeVertical 合并第 col 列中 [fromRow, toRow] 行的单元格，keepContent 为 true 时保留被合并单元格中的非空段落
+func mergeVertical(tbl string, col, fromRow, toRow int, keepContent bool) (string, error) {
+	rows := findElements(tbl, "w:tr")
+	if fromRow < 0 || toRow >= len(rows) || fromRow >= toRow {
+		return tbl, ErrCellRange
+	}
+
+	var sb, extra strings.Builder
+	last, firstEnd := 0, 0
+	for i := fromRow; i <= toRow; i++ {
+		r := tbl[rows[i][0]:rows[i][1]]
+		c, ok := cellAt(rowCells(r), col)
+		if !ok || c.col != col {
+			return tbl, ErrCellRange
+		}
+		cell := r[c.start:c.end]
+		if i == fromRow {
+			cell = setCellProp(cell, "w:vMerge", `<w:vMerge w:val="restart"/>`)
+		} else {
+			if keepContent {
+				extra.WriteString(cellContent(cell))
+			}
+			_, propsEnd := cellProps(cell)
+			cell = setCellProp(cell[:propsEnd]+`<w:p/></w:tc>`, "w:vMerge", `<w:vMerge/>`)
+		}
+		sb.WriteString(tbl[last : rows[i][0]+c.start])
+		if i == fromRow {
+			firstEnd = sb.Len() + len(cell)
+		}
+		sb.WriteString(cell)
+		last = rows[i][0] + c.end
+	}
+	sb.WriteString(tbl[last:])
+
+	res := sb.String()
+	if extra.Len() > 0 {
+		// 第一个单元格以 </w:tc> 结尾，在其之前追加内容
+		pos := firstEnd - len(`</w:tc>`)
+		res = StringBuilder(res[:pos], extra.String(), res[pos:])
+	}
+	return res, nil
+}
+
+// columnTexts 表格每一行中从第 col 列开始的单元格的文本，没有该单元格的行与表头行为空
+func columnTexts(tbl string, col int) []string {
+	rows := findElements(tbl, "w:tr")
+	texts := make([]string, len(rows))
+	for i, rr := range rows {
+		r := tbl[rr[0]:rr[1]]
+		if isHeaderRow(r) {
+			continue
+		}
+		if c, ok := cellAt(rowCells(r), col); ok && c.col == col {
+			texts[i] = strings.TrimSpace(stripTags(r[c.start:c.end]))
+		}
+	}
+	return texts
+}
+
+// isHeaderRow 判断行是否为重复的表头行 (w:trPr 中的 w:tblHeader)
+func isHeaderRow(row string) bool {
+	gt := strings.IndexByte(row, '>') + 1
+	if !isOpenTag(row, gt, "w:trPr") {
+		return false
+	}
+	start, end := findElement(row, gt, "w:trPr")
+	props := row[start:end]
+	i := strings.Index(props, "<w:tblHeader")
+	if i == -1 || !isOpenTag(props, i, "w:tblHeader") {
+		return false
+	}
+	tag := props[i : strings.IndexByte(props[i:], '>')+i+1]
+	switch attrValue(tag, "w:val") {
+	case "0", "false", "off":
+		return false
+	}
+	return true
+}
+
+// cellContent 单元格中含有文本的内容 (去掉 w:tcPr)，没有文本时为空
+func cellContent(cell string) string {
+	_, end := cellProps(cell)
+	content := cell[end : len(cell)-len(`</w:tc>`)]
+	if strings.TrimSpace(stripTags(content)) == "" {
+		return ""
+	}
+	return content
+}
+
+// appendCellContent 在单元格末尾追加内容
+func appendCellContent(cell, content string) string {
+	if content == "" {
+		return cell
+	}
+	pos := len(cell) - len(`</w:tc>`)
+	return StringBuilder(cell[:pos], content, cell[pos:])
+}
@@ -0,0 +1,119 @@
+package docx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testCell 构造指定宽度与跨列数的单元格
+func testCell(text string, width, span int) string {
+	props := `<w:tcW w:w="` + strconv.Itoa(width) + `" w:type="dxa"/>`
+	if span > 1 {
+		props += `<w:gridSpan w:val="` + strconv.Itoa(span) + `"/>`
+	}
+	return `<w:tc><w:tcPr>` + props + `</w:tcPr>` + testParagraph(text) + `</w:tc>`
+}
+
+func TestCloneColumn(t *testing.T) {
+	tbl := func(grid string, rows ...string) string {
+		return `<w:tbl><w:tblPr/><w:tblGrid>` + grid + `</w:tblGrid>` + strings.Join(rows, "") + `</w:tbl>`
+	}
+	doc := newTestDocx(t, tbl(`<w:gridCol w:w="2000"/><w:gridCol w:w="3000"/>`,
+		`<w:tr>`+testCell(`Item`, 2000, 1)+testCell(`{{q}}`, 3000, 1)+`</w:tr>`,
+		`<w:tr>`+testCell(`Total`, 5000, 2)+`</w:tr>`,
+		`<w:tr>`+testCell(`A`, 2000, 1)+testCell(`{{price}}`, 3000, 1)+`</w:tr>`,
+	))
+	defer doc.Close()
+
+	if err := doc.CloneColumn("q", 3); err != nil {
+		t.Fatalf("复制列失败: %v", err)
+	}
+	want := tbl(`<w:gridCol w:w="2000"/><w:gridCol w:w="1000"/><w:gridCol w:w="1000"/><w:gridCol w:w="1000"/>`,
+		`<w:tr>`+testCell(`Item`, 2000, 1)+testCell(`{{q#0}}`, 1000, 1)+testCell(`{{q#1}}`, 1000, 1)+testCell(`{{q#2}}`, 1000, 1)+`</w:tr>`,
+		`<w:tr>`+testCell(`Total`, 5000, 4)+`</w:tr>`,
+		`<w:tr>`+testCell(`A`, 2000, 1)+testCell(`{{price#0}}`, 1000, 1)+testCell(`{{price#1}}`, 1000, 1)+testCell(`{{price#2}}`, 1000, 1)+`</w:tr>`,
+	)
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("复制列结果错误: %s", doc.MainPart)
+	}
+
+	if err := doc.CloneColumn("price#0", 0); err != nil {
+		t.Fatalf("删除列失败: %v", err)
+	}
+	if strings.Contains(doc.MainPart, `{{q#0}}`) || !strings.Contains(doc.MainPart, testCell(`Total`, 4000, 3)) {
+		t.Errorf("删除列结果错误: %s", doc.MainPart)
+	}
+}
+
+func TestCloneColumnRemovesTable(t *testing.T) {
+	body := `<w:tbl><w:tblPr/><w:tblGrid><w:gridCol w:w="2000"/></w:tblGrid>` +
+		`<w:tr>` + testCell(`{{q}}`, 2000, 1) + `</w:tr><w:tr>` + testCell(`A`, 2000, 1) + `</w:tr></w:tbl>` +
+		testParagraph(`after`)
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.CloneColumn("q", 0); err != nil {
+		t.Fatalf("删除列失败: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, `<w:body>`+testParagraph(`after`)+`</w:body>`) {
+		t.Errorf("删除唯一的列后应删除整个表格: %s", doc.MainPart)
+	}
+	if err := doc.CloneColumn("after", -1); err == nil {
+		t.Error("列数为负数时应返回错误")
+	}
+}
+
+func TestMergeCells(t *testing.T) {
+	row := func(cells ...string) string {
+		return `<w:tr>` + strings.Join(cells, "") + `</w:tr>`
+	}
+	doc := newTestDocx(t, `<w:tbl>`+
+		`<w:tr><w:trPr><w:tblHeader/></w:trPr>`+testCell(`{{region}}`, 1000, 1)+testCell(`City`, 1000, 1)+testCell(`Sales`, 1000, 1)+`</w:tr>`+
+		row(testCell(`North`, 1000, 1), testCell(`A`, 1000, 1), testCell(`1`, 1000, 1))+
+		row(testCell(`North`, 1000, 1), testCell(`B`, 1000, 1), testCell(`2`, 1000, 1))+
+		row(testCell(`South`, 1000, 1), testCell(`C`, 1000, 1), testCell(`3`, 1000, 1))+
+		`</w:tbl>`)
+	defer doc.Close()
+
+	if err := doc.AutoMergeColumn("North", 0); !errors.Is(err, ErrPlaceholderNotFound) {
+		t.Errorf("不应按单元格中的普通文本查找表格: %v", err)
+	}
+	if err := doc.AutoMergeColumn("region", 0); err != nil {
+		t.Fatalf("自动合并失败: %v", err)
+	}
+	if err := doc.MergeCellsHorizontal("region", 3, 1, 2); err != nil {
+		t.Fatalf("横向合并失败: %v", err)
+	}
+	if err := doc.MergeCellsVertical("region", 2, 0, 3); err == nil {
+		t.Error("与已合并单元格边界不一致时应返回错误")
+	}
+
+	merged := func(text, vMerge string) string {
+		return `<w:tc><w:tcPr><w:tcW w:w="1000" w:type="dxa"/>` + vMerge + `</w:tcPr>` + text + `</w:tc>`
+	}
+	for _, want := range []string{
+		merged(testParagraph(`North`), `<w:vMerge w:val="restart"/>`) + testCell(`A`, 1000, 1),
+		merged(`<w:p/>`, `<w:vMerge/>`) + testCell(`B`, 1000, 1),
+		testCell(`South`, 1000, 1) + `<w:tc><w:tcPr><w:tcW w:w="2000" w:type="dxa"/><w:gridSpan w:val="2"/></w:tcPr>` + testParagraph(`C`) + testParagraph(`3`) + `</w:tc></w:tr>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("合并结果中缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+}
+
+func TestAutoMergeColumnSkipsHeader(t *testing.T) {
+	header := `<w:tr><w:trPr><w:tblHeader/></w:trPr>` + testCell(`A`, 1000, 1) + testCell(`{{t}}`, 1000, 1) + `</w:tr>`
+	data := `<w:tr>` + testCell(`A`, 1000, 1) + testCell(`x`, 1000, 1) + `</w:tr>`
+	doc := newTestDocx(t, `<w:tbl>`+header+data+data+`</w:tbl>`)
+	defer doc.Close()
+
+	if err := doc.AutoMergeColumn("t", 0); err != nil {
+		t.Fatalf("自动合并失败: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, header) || strings.Count(doc.MainPart, `<w:vMerge`) != 2 {
+		t.Errorf("表头行不应参与合并: %s", doc.MainPart)
+	}
+}
@@ -25,7 +25,7 @@ func main() {
 	}
 
 	// 解析数据
-	var values map[string]string
+	var values map[string]interface{}
 	if err := json.Unmarshal([]byte(*data), &values); err != nil {
 		// 尝试作为文件读取
 		content, err := os.ReadFile(*data)
@@ -51,8 +51,11 @@ func main() {
 	}
 	defer doc.Close()
 
-	// 替换
-	doc.SetValue(values)
+	// 替换 (支持嵌套对象、数组以及条件块和循环块)
+	if err := doc.Render(values); err != nil {
+		fmt.Printf("错误: 渲染失败: %v\n", err)
+		return
+	}
 
 	// 保存
 	if err := doc.SaveToFile(*output); err != nil {
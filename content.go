@@ -0,0 +1,278 @@
+package docx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	listIndent     = 720      // 每一级列表、引用的缩进 (twip)
+	hyperlinkColor = "0563C1" // 超链接文字的颜色
+)
+
+// contentBlock 块级内容，HTML、Markdown 先转换为块再生成 WordprocessingML
+type contentBlock struct {
+	style  string        // 段落样式的名称，如 heading 1、Quote，生成时查找或添加对应的样式
+	list   *listItem     // 列表项，为 nil 时不是列表
+	indent int           // 左缩进 (twip)
+	align  string        // 对齐方式: left、center、right、both
+	rule   bool          // 水平线 (段落下边框)
+	runs   []inlineRun   // 段落内容
+	table  *contentTable // 不为 nil 时为表格，其他字段不使用
+}
+
+// listItem 列表项的编号信息
+type listItem struct {
+	id      int  // 同一列表的项 id 相同，共用一个编号定义
+	ordered bool // 有序列表
+	level   int  // 嵌套层级，从 0 开始
+	start   int  // 有序列表的起始编号，0 时从 1 开始
+}
+
+// contentTable 表格
+type contentTable struct {
+	rows   [][]contentCell
+	header int // 开头的表头行数
+}
+
+// contentCell 单元格
+type contentCell struct {
+	span   int // 合并的列数，0 时为 1
+	blocks []contentBlock
+}
+
+// inlineRun 段落中的一段文字或图片
+type inlineRun struct {
+	TextSegment
+	style string    // 字符样式的名称，如 HTML Code
+	link  string    // 超链接地址，# 开头时为文档内书签
+	image *ImgValue // 不为 nil 时为图片，文字与格式不使用
+}
+
+// replaceParagraphs 将所有部件中包含 mark 的段落替换为 blocks 生成的内容
+// mark 不存在时返回 ErrPlaceholderNotFound，不在任何段落中时返回 ErrNotInParagraph
+func (d *Docx) replaceParagraphs(mark string, blocks []contentBlock) error {
+	mark = ensureMacroCompleted(d, mark)
+	found, replaced := false, 0
+	err := d.updateTrees(func(partName string, root *node) (bool, error) {
+		changed := false
+		for _, t := range root.texts(mark) {
+			found = true
+			p := t.ancestor("w:p")
+			if p == nil || !p.attached(root) {
+				continue
+			}
+			w := &contentWriter{d: d, partName: partName, nums: make(map[int]int), styles: make(map[string]string)}
+			w.blocks(blocks)
+			nodes, err := parseFragment(w.sb.String())
+			if err != nil {
+				return changed, err
+			}
+			parent := p.parent
+			p.replaceWith(nodes...)
+			// 单元格的最后一个元素必须是段落
+			if parent.name == "w:tc" {
+				if last := lastElement(parent); last == nil || last.name != "w:p" {
+					parent.append(&node{typ: elementNode, name: "w:p", open: "<w:p/>"})
+				}
+			}
+			changed = true
+			replaced++
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, mark)
+	}
+	if replaced == 0 {
+		return fmt.Errorf("%w: %s", ErrNotInParagraph, mark)
+	}
+	return nil
+}
+
+// lastElement 返回最后一个子元素，没有时为 nil
+func lastElement(n *node) *node {
+	for i := len(n.children) - 1; i >= 0; i-- {
+		if n.children[i].typ == elementNode {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// contentWriter 生成一个部件中块的 XML，图片与超链接的关系登记在该部件中
+type contentWriter struct {
+	d        *Docx
+	partName string
+	nums     map[int]int       // listItem.id 对应的 w:numId
+	styles   map[string]string // 样式名称对应的 id
+	sb       strings.Builder
+}
+
+func (w *contentWriter) blocks(blocks []contentBlock) {
+	for _, b := range blocks {
+		if b.table != nil {
+			w.table(b.table)
+		} else {
+			w.paragraph(b)
+		}
+	}
+}
+
+// styleID 查找样式 id，结果在本次生成中缓存
+func (w *contentWriter) styleID(name string) string {
+	id, ok := w.styles[name]
+	if !ok {
+		id = w.d.styleID(name)
+		w.styles[name] = id
+	}
+	return id
+}
+
+func (w *contentWriter) paragraph(b contentBlock) {
+	var pPr strings.Builder
+	if b.style != "" {
+		pPr.WriteString(`<w:pStyle w:val="` + escapeText(w.styleID(b.style)) + `"/>`)
+	}
+	if b.list != nil {
+		numID, ok := w.nums[b.list.id]
+		if !ok {
+			numID = w.d.addNumbering(b.list.ordered, b.list.start)
+			w.nums[b.list.id] = numID
+		}
+		pPr.WriteString(`<w:numPr><w:ilvl w:val="` + strconv.Itoa(b.list.level) + `"/><w:numId w:val="` + strconv.Itoa(numID) + `"/></w:numPr>`)
+	}
+	if b.rule {
+		pPr.WriteString(`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr>`)
+	}
+	if b.indent > 0 {
+		pPr.WriteString(`<w:ind w:left="` + strconv.Itoa(b.indent) + `"/>`)
+	}
+	if b.align != "" {
+		pPr.WriteString(`<w:jc w:val="` + b.align + `"/>`)
+	}
+
+	w.sb.WriteString(`<w:p>`)
+	if pPr.Len() > 0 {
+		w.sb.WriteString(`<w:pPr>` + pPr.String() + `</w:pPr>`)
+	}
+	w.runs(b.runs)
+	w.sb.WriteString(`</w:p>`)
+}
+
+// runs 生成段落内容，链接相同的相邻 run 放在同一个 w:hyperlink 中
+func (w *contentWriter) runs(runs []inlineRun) {
+	for i := 0; i < len(runs); {
+		link := runs[i].link
+		j := i + 1
+		for j < len(runs) && runs[j].link == link {
+			j++
+		}
+		switch {
+		case strings.HasPrefix(link, "#"):
+			w.sb.WriteString(`<w:hyperlink w:anchor="` + escapeText(link[1:]) + `" w:history="1">`)
+		case link != "":
+			rid := w.d.addRelationship(w.partName, hyperlinkRelType, link, true)
+			w.sb.WriteString(`<w:hyperlink xmlns:r="` + nsRelationships + `" r:id="` + rid + `" w:history="1">`)
+		}
+		for _, r := range runs[i:j] {
+			w.run(r)
+		}
+		if link != "" {
+			w.sb.WriteString(`</w:hyperlink>`)
+		}
+		i = j
+	}
+}
+
+func (w *contentWriter) run(r inlineRun) {
+	if r.image != nil {
+		// 每张图片的 wp:docPr id 都不同，用作登记图片的键
+		img := *r.image
+		blipRid, svgRid := w.d.registerImage(w.partName, w.partName+"#content"+strconv.Itoa(w.d.docPrID), &img)
+		w.sb.WriteString(`<w:r>` + w.d.drawingXML(img, blipRid, svgRid) + `</w:r>`)
+		return
+	}
+	if r.link != "" {
+		if r.Color == "" {
+			r.Color = hyperlinkColor
+		}
+		r.Underline = true
+	}
+	// properties 已按 w:rPr 的顺序生成，字符样式在最前
+	var rPr strings.Builder
+	if r.style != "" {
+		rPr.WriteString(`<w:rStyle w:val="` + escapeText(w.styleID(r.style)) + `"/>`)
+	}
+	for _, p := range r.properties() {
+		rPr.WriteString(p.open)
+	}
+	w.sb.WriteString(textRun(r.Text, rPr.String()))
+}
+
+// table 生成表格，列宽平均分配 defaultTableWidth
+func (w *contentWriter) table(t *contentTable) {
+	cols := 1
+	for _, row := range t.rows {
+		n := 0
+		for _, c := range row {
+			n += c.columns()
+		}
+		if n > cols {
+			cols = n
+		}
+	}
+	width := defaultTableWidth / cols
+
+	w.sb.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="` + strconv.Itoa(width*cols) + `" w:type="dxa"/>`)
+	w.sb.WriteString((&TableBorder{}).xml())
+	w.sb.WriteString(`<w:tblLayout w:type="fixed"/><w:tblLook w:val="04A0" w:firstRow="1" w:lastRow="0" w:firstColumn="1" w:lastColumn="0" w:noHBand="0" w:noVBand="1"/></w:tblPr><w:tblGrid>`)
+	for i := 0; i < cols; i++ {
+		w.sb.WriteString(`<w:gridCol w:w="` + strconv.Itoa(width) + `"/>`)
+	}
+	w.sb.WriteString(`</w:tblGrid>`)
+
+	for r, row := range t.rows {
+		w.sb.WriteString(`<w:tr>`)
+		if r < t.header {
+			w.sb.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+		}
+		n := 0
+		for _, c := range row {
+			n += c.columns()
+			w.cell(c, width)
+		}
+		// 列数不足的行以空单元格补齐
+		for ; n < cols; n++ {
+			w.cell(contentCell{}, width)
+		}
+		w.sb.WriteString(`</w:tr>`)
+	}
+	w.sb.WriteString(`</w:tbl>`)
+}
+
+func (w *contentWriter) cell(c contentCell, width int) {
+	span := c.columns()
+	w.sb.WriteString(`<w:tc><w:tcPr><w:tcW w:w="` + strconv.Itoa(width*span) + `" w:type="dxa"/>`)
+	if span > 1 {
+		w.sb.WriteString(`<w:gridSpan w:val="` + strconv.Itoa(span) + `"/>`)
+	}
+	w.sb.WriteString(`</w:tcPr>`)
+	w.blocks(c.blocks)
+	if len(c.blocks) == 0 || c.blocks[len(c.blocks)-1].table != nil {
+		w.sb.WriteString(`<w:p/>`)
+	}
+	w.sb.WriteString(`</w:tc>`)
+}
+
+// columns 单元格占用的列数
+func (c contentCell) columns() int {
+	if c.span > 1 {
+		return c.span
+	}
+	return 1
+}
@@ -0,0 +1,115 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotInTable 占位符不在表格中
+	ErrNotInTable = errors.New("docx: placeholder is not inside a table")
+	// ErrNotInParagraph 占位符不在段落中
+	ErrNotInParagraph = errors.New("docx: placeholder is not inside a paragraph")
+)
+
+// DeleteRow 删除所有包含标记的表格行，表格因此不再有任何行时删除整个表格
+func (d *Docx) DeleteRow(mark string) error {
+	return d.replaceElements(mark, "w:tr", "", ErrNotInTableRow)
+}
+
+// DeleteTable 删除所有包含标记的表格 (嵌套表格时为最内层的表格)
+func (d *Docx) DeleteTable(mark string) error {
+	return d.replaceElements(mark, "w:tbl", "", ErrNotInTable)
+}
+
+// DeleteParagraph 删除所有包含标记的段落
+func (d *Docx) DeleteParagraph(mark string) error {
+	return d.replaceElements(mark, "w:p", "", ErrNotInParagraph)
+}
+
+// replaceElements 将所有部件中包含 mark 的最内层 tag 元素替换为 xml，xml 为空时即删除
+// mark 不存在时返回 ErrPlaceholderNotFound，不在任何 tag 元素中时返回 notInside
+func (d *Docx) replaceElements(mark, tag, xml string, notInside error) error {
+	mark = ensureMacroCompleted(d, mark)
+	found, replaced := false, 0
+	err := d.updateParts(func(_, content string) (string, error) {
+		from := 0
+		for {
+			pos := strings.Index(content[from:], mark)
+			if pos == -1 {
+				return content, nil
+			}
+			pos += from
+			found = true
+
+			//查找标记点所在元素的边界
+			start, end := findElement(content, pos, tag)
+			if start == -1 {
+				from = pos + len(mark)
+				continue
+			}
+			content = replaceElement(content, start, end, xml)
+			from = start + len(xml)
+			if tag == "w:tr" && xml == "" {
+				// 表格被删除时其后的内容前移到表格的位置
+				var tbl int
+				if content, tbl = removeEmptyTable(content, start); tbl != -1 {
+					from = tbl
+				}
+			}
+			replaced++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, mark)
+	}
+	if replaced == 0 {
+		return fmt.Errorf("%w: %s", notInside, mark)
+	}
+	return nil
+}
+
+// replaceElement 将 [start, end) 的元素替换为 xml
+// 单元格的最后一个元素必须是段落，替换后不满足时补充一个空段落
+func replaceElement(content string, start, end int, xml string) string {
+	before := content[:start] + xml
+	after := content[end:]
+	if strings.HasPrefix(after, `</w:tc>`) && !strings.HasSuffix(before, `</w:p>`) && !strings.HasSuffix(before, `<w:p/>`) {
+		before += `<w:p/>`
+	}
+	return before + after
+}
+
+// removeElement 删除 [start, end) 的元素
+func removeElement(content string, start, end int) string {
+	return replaceElement(content, start, end, "")
+}
+
+// removeEmptyTable 删除行之后，若 pos 所在的表格已没有任何行则删除整个表格
+// 返回新的内容以及被删除表格的起始位置，没有删除时为 -1
+func removeEmptyTable(content string, pos int) (string, int) {
+	start, end := findElement(content, pos, "w:tbl")
+	if start == -1 || strings.Contains(content[start:end], `<w:tr`) {
+		return content, -1
+	}
+	return removeElement(content, start, end), start
+}
+
+// removeEmptyTableNode 删除行之后，若表格已没有任何行则删除整个表格
+// 单元格的最后一个元素必须是段落，删除后不满足时补充一个空段落
+func removeEmptyTableNode(tbl *node) {
+	if tbl == nil || tbl.name != "w:tbl" || len(tbl.elements("w:tr")) > 0 {
+		return
+	}
+	parent := tbl.parent
+	tbl.remove()
+	if parent != nil && parent.name == "w:tc" {
+		if last := lastElement(parent); last == nil || last.name != "w:p" {
+			parent.append(&node{typ: elementNode, name: "w:p", open: "<w:p/>"})
+		}
+	}
+}
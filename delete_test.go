@@ -0,0 +1,59 @@
+package docx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	cell := func(content string) string {
+		return `<w:tbl><w:tr><w:tc>` + content + `</w:tc></w:tr></w:tbl>`
+	}
+	body := `<w:tbl>` + testRow(`Name`) + testRow(`{{discount}}`) + `</w:tbl>` +
+		`<w:tbl>` + testRow(`{{only}}`) + `</w:tbl>` +
+		cell(testParagraph(`keep`)+`<w:tbl>`+testRow(`{{nested}}`)+`</w:tbl>`) +
+		cell(testParagraph(`{{note}}`)) +
+		testParagraph(`{{note}}`)
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.DeleteRow("discount"); err != nil {
+		t.Fatalf("删除行失败: %v", err)
+	}
+	if err := doc.DeleteRow("only"); err != nil {
+		t.Fatalf("删除行失败: %v", err)
+	}
+	if err := doc.DeleteTable("nested"); err != nil {
+		t.Fatalf("删除表格失败: %v", err)
+	}
+	if err := doc.DeleteParagraph("note"); err != nil {
+		t.Fatalf("删除段落失败: %v", err)
+	}
+
+	want := `<w:tbl>` + testRow(`Name`) + `</w:tbl>` +
+		cell(testParagraph(`keep`)) +
+		cell(`<w:p/>`)
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("删除结果错误: %s", doc.MainPart)
+	}
+
+	if err := doc.DeleteParagraph("note"); !errors.Is(err, ErrPlaceholderNotFound) {
+		t.Errorf("占位符不存在时应返回 ErrPlaceholderNotFound: %v", err)
+	}
+}
+
+func TestDeleteRowRemovesSeveralTables(t *testing.T) {
+	tbl := `<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid><w:gridCol w:w="9000"/></w:tblGrid>` +
+		`<w:tr><w:tc>` + testParagraph(`{{x}}`) + `</w:tc></w:tr></w:tbl>`
+	doc := newTestDocx(t, tbl+`<w:p/>`+tbl)
+	defer doc.Close()
+
+	if err := doc.DeleteRow("x"); err != nil {
+		t.Fatalf("删除行失败: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, `<w:body><w:p/></w:body>`) {
+		t.Errorf("两个表格都应被删除: %s", doc.MainPart)
+	}
+}
@@ -10,9 +10,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -20,11 +21,14 @@ import (
 type Config struct {
 	PlaceholderPrefix string // 占位符前缀，如 {{
 	PlaceholderSuffix string // 占位符后缀，如 }}
+	TimeFormat        string // Render 中 time.Time 的格式，为空时使用 2006-01-02
+	Strict            bool   // 严格模式: SetValue 的键未匹配任何占位符时返回错误，保存时仍有未填充的占位符则拒绝写入
 }
 
 var DefaultConfig = Config{
 	PlaceholderPrefix: "{{",
 	PlaceholderSuffix: "}}",
+	TimeFormat:        defaultTimeFormat,
 }
 
 // Docx 文档
@@ -39,9 +43,17 @@ type Docx struct {
 	ContentTypesName string
 	Headers          map[int]string
 	Footers          map[int]string
+	Footnotes        string // word/footnotes.xml，不存在时为空
+	Endnotes         string // word/endnotes.xml，不存在时为空
 	Relations        map[string]string
 	NewImages        map[string]ImgValue
 	Config           Config
+
+	unusedKeys map[string]bool   // 未匹配任何占位符的键
+	docPrID    int               // 已使用的最大 wp:docPr id
+	media      map[string][]byte // 替换或新增的 media 文件，键为包内路径
+	report     MediaReport       // 最近一次保存时 media 的整理结果
+	parts      map[string]string // 修改或新增的其他部件 (如 styles.xml、numbering.xml)，键为包内路径
 }
 
 // ZipData Contains functions to work with data from a zip file
@@ -114,6 +126,8 @@ func LoadFromReader(r io.ReaderAt, size int64, config Config) (*Docx, error) {
 	Relations := make(map[string]string)
 	Headers := b.getTempDocumentHeaders(Relations)
 	Footers := b.getTempDocumentFooters(Relations)
+	Footnotes := b.getTempDocumentPart(getFootnotesName(), Relations)
+	Endnotes := b.getTempDocumentPart(getEndnotesName(), Relations)
 	MainPartName, MainPart := b.getTempDocumentMainPart(Relations)
 	SettingsPartName, SettingsPart := b.getTempDocumentSettingsPart(Relations)
 	ContentTypesName, ContentTypes := b.getTempDocumentContentTypes(Relations)
@@ -122,6 +136,8 @@ func LoadFromReader(r io.ReaderAt, size int64, config Config) (*Docx, error) {
 		ZipBuffer:        b,
 		Headers:          Headers,
 		Footers:          Footers,
+		Footnotes:        Footnotes,
+		Endnotes:         Endnotes,
 		Relations:        Relations,
 		MainPartName:     MainPartName,
 		MainPart:         MainPart,
@@ -131,6 +147,9 @@ func LoadFromReader(r io.ReaderAt, size int64, config Config) (*Docx, error) {
 		ContentTypesName: ContentTypesName,
 		NewImages:        make(map[string]ImgValue),
 		Config:           config,
+		unusedKeys:       make(map[string]bool),
+		media:            make(map[string][]byte),
+		parts:            make(map[string]string),
 	}
 
 	d.fixBrokenMacros()
@@ -144,6 +163,12 @@ func (d *Docx) save() error {
 
 // SaveToFile 另存为
 func (d *Docx) SaveToFile(path string) (err error) {
+	// 严格模式的检查在创建文件之前进行，失败时不影响已有的文件
+	if d.Config.Strict {
+		if err := d.Unresolved(); err != nil {
+			return err
+		}
+	}
 	w, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
@@ -155,11 +180,32 @@ func (d *Docx) SaveToFile(path string) (err error) {
 
 // WriteTo 将文档写入指定 Writer，符合 io.WriterTo 接口
 func (d *Docx) WriteTo(w io.Writer) (int64, error) {
+	if d.Config.Strict {
+		if err := d.Unresolved(); err != nil {
+			return 0, err
+		}
+	}
+
+	media, relations, contentTypes, err := d.prepareMedia()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare media: %w", err)
+	}
+
 	cw := &countingWriter{w: w}
 	wr := zip.NewWriter(cw)
 	defer wr.Close()
 
 	for _, file := range d.ZipBuffer.files() {
+		// media 文件已在 prepareMedia 中整理，被删除的不再写入
+		if data, ok := media[file.Name]; ok || isMediaName(file.Name) {
+			if ok {
+				if err = writeZipFile(wr, file.Name, data); err != nil {
+					return cw.count, fmt.Errorf("failed to save media %s: %w", file.Name, err)
+				}
+			}
+			continue
+		}
+
 		xmlString := d.ZipBuffer.getFromName(file.Name)
 		for headerIndex, header := range d.Headers {
 			if file.Name == getHeaderName(headerIndex) {
@@ -173,6 +219,14 @@ func (d *Docx) WriteTo(w io.Writer) (int64, error) {
 			}
 		}
 
+		if file.Name == getFootnotesName() && d.Footnotes != "" {
+			xmlString = d.Footnotes
+		}
+
+		if file.Name == getEndnotesName() && d.Endnotes != "" {
+			xmlString = d.Endnotes
+		}
+
 		if file.Name == d.SettingsPartName {
 			xmlString = d.SettingsPart
 		}
@@ -181,22 +235,28 @@ func (d *Docx) WriteTo(w io.Writer) (int64, error) {
 			xmlString = d.MainPart
 		}
 
-		if file.Name == d.ContentTypesName && d.ContentTypes != "" {
-			xmlString = d.ContentTypes
+		if file.Name == d.ContentTypesName && contentTypes != "" {
+			xmlString = contentTypes
 		}
 
-		err := d.savePartWithRels(wr, file.Name, xmlString)
+		if part, ok := d.parts[file.Name]; ok {
+			xmlString = part
+		}
+
+		err = d.savePartWithRels(wr, relations, file.Name, xmlString)
 		if err != nil {
 			return cw.count, fmt.Errorf("failed to save part %s: %w", file.Name, err)
 		}
 	}
 
-	// 写入图片文件
-	if len(d.NewImages) > 0 {
-		err := d.saveImages(wr)
-		if err != nil {
-			return cw.count, fmt.Errorf("failed to save images: %w", err)
-		}
+	// 写入新增的 media 文件
+	if err = d.saveMedia(wr, media); err != nil {
+		return cw.count, fmt.Errorf("failed to save media: %w", err)
+	}
+
+	// 写入新增的部件
+	if err = d.saveParts(wr, relations); err != nil {
+		return cw.count, fmt.Errorf("failed to save parts: %w", err)
 	}
 
 	wr.Close()
@@ -221,41 +281,70 @@ func (d *Docx) SaveToBuffer() (*bytes.Buffer, error) {
 	return buf, err
 }
 
-func (d *Docx) saveImages(wr *zip.Writer) error {
-	var repetition = make([]string, 0, len(d.NewImages))
-
-	for _, image := range d.NewImages {
-		//在切片中查找重复
-		if findStrInSlice(repetition, image.Replace) != -1 {
-			continue
+// saveMedia 写入原文档中不存在的 media 文件，已存在的在遍历原文件时写入
+func (d *Docx) saveMedia(wr *zip.Writer, media map[string][]byte) error {
+	names := make([]string, 0, len(media))
+	for name := range media {
+		if d.ZipBuffer.locateName(name) == -1 {
+			names = append(names, name)
 		}
-
-		writer, err := wr.Create(`word/media/` + image.Replace)
-		if err != nil {
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeZipFile(wr, name, media[name]); err != nil {
 			return err
 		}
-		f, err := os.Open(image.Path)
-		if err != nil {
-			return fmt.Errorf("failed to open image %s: %w", image.Path, err)
-		}
-		imageContent, err := ioutil.ReadAll(f)
-		f.Close() // 显式关闭图片文件
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+// saveParts 写入原文档中不存在的部件，已存在的在遍历原文件时写入
+func (d *Docx) saveParts(wr *zip.Writer, relations map[string]string) error {
+	names := make([]string, 0, len(d.parts))
+	for name := range d.parts {
+		if d.ZipBuffer.locateName(name) == -1 {
+			names = append(names, name)
 		}
-		_, err = writer.Write(imageContent)
-		if err != nil {
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := d.savePartWithRels(wr, relations, name, d.parts[name]); err != nil {
 			return err
 		}
-		repetition = append(repetition, image.Replace)
 	}
-
 	return nil
 }
 
-func (d *Docx) savePartWithRels(wr *zip.Writer, filename, xml string) (err error) {
+// part 返回包内部件的内容，修改过的部件优先
+func (d *Docx) part(name string) string {
+	if s, ok := d.parts[name]; ok {
+		return s
+	}
+	return d.ZipBuffer.getFromName(name)
+}
+
+// setPart 修改或新增部件，保存时写入
+func (d *Docx) setPart(name, content string) {
+	if d.parts == nil {
+		d.parts = make(map[string]string)
+	}
+	d.parts[name] = content
+}
 
-	if _, ok := d.Relations[getRemoveRelationsName(filename)]; ok && getRemoveRelationsName(filename) != filename {
+// writeZipFile 向 zip 写入一个文件
+func writeZipFile(wr *zip.Writer, name string, data []byte) error {
+	writer, err := wr.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// savePartWithRels 写入部件及 relations 中它的关系文件
+func (d *Docx) savePartWithRels(wr *zip.Writer, relations map[string]string, filename, xml string) (err error) {
+
+	if _, ok := relations[getRemoveRelationsName(filename)]; ok && getRemoveRelationsName(filename) != filename {
 		return nil
 	}
 
@@ -269,7 +358,7 @@ func (d *Docx) savePartWithRels(wr *zip.Writer, filename, xml string) (err error
 		return err
 	}
 
-	if v, ok := d.Relations[filename]; ok {
+	if v := relations[filename]; v != "" {
 		relsFileName := getRelationsName(filename)
 
 		relsWriter, err := wr.Create(relsFileName)
@@ -288,44 +377,108 @@ func (d *Docx) savePartWithRels(wr *zip.Writer, filename, xml string) (err error
 SetValue 替换文本
 
 	(d *Docx) SetValue( map[search]replace )
+	(d *Docx) SetValue( map[search]interface{} )    值为 string 或 RichText
 	(d *Docx) SetValue( search string, replace string)
+	(d *Docx) SetValue( search string, replace RichText)
 */
 func (d *Docx) SetValue(s ...interface{}) error {
 	if len(s) != 2 && len(s) != 1 {
 		return errors.New("参数长度错误")
 	}
 
+	var reps []replacement
 	//如果第一个参数为map
 	if reflect.TypeOf(s[0]).Kind() == reflect.Map {
-		m, ok := s[0].(map[string]string)
-		if !ok {
-			return errors.New("map参数类型错误，应为 map[string]string")
+		values := make(map[string]interface{})
+		switch m := s[0].(type) {
+		case map[string]string:
+			for search, replace := range m {
+				values[search] = replace
+			}
+		case map[string]interface{}:
+			values = m
+		default:
+			return errors.New("map参数类型错误，应为 map[string]string 或 map[string]interface{}")
 		}
-		for search, replace := range m {
-			d.replace(search, replace, -1)
+		for search, replace := range values {
+			var rep replacement
+			var err error
+			switch v := replace.(type) {
+			case string:
+				rep, err = d.newReplacement(search, v, nil)
+			case RichText:
+				rep, err = d.newReplacement(search, v.String(), v)
+			default:
+				return fmt.Errorf("map参数值类型错误，%s 的值应为 string 或 RichText", search)
+			}
+			if err != nil {
+				return err
+			}
+			reps = append(reps, rep)
 		}
+	} else if rt, ok := s[len(s)-1].(RichText); ok && len(s) == 2 && reflect.TypeOf(s[0]).Kind() == reflect.String {
+		rep, err := d.newReplacement(s[0].(string), rt.String(), rt)
+		if err != nil {
+			return err
+		}
+		reps = append(reps, rep)
 	} else if len(s) == 2 && reflect.TypeOf(s[0]).Kind() == reflect.String && reflect.TypeOf(s[1]).Kind() == reflect.String {
-		d.replace(s[0].(string), s[1].(string), -1)
+		rep, err := d.newReplacement(s[0].(string), s[1].(string), nil)
+		if err != nil {
+			return err
+		}
+		reps = append(reps, rep)
 	} else {
 		return errors.New("参数类型错误")
 	}
 
+	counts, err := d.replaceAll(reps)
+	if err != nil {
+		return err
+	}
+	var extra []string
+	for i, rep := range reps {
+		d.recordKey(rep.key, counts[i])
+		if counts[i] == 0 {
+			extra = append(extra, rep.key)
+		}
+	}
+
+	if d.Config.Strict && len(extra) > 0 {
+		sort.Strings(extra)
+		return &PlaceholderError{Extra: extra}
+	}
 	return nil
 }
 
-// replace 替换文本
-func (d *Docx) replace(search, replace string, limit int) error {
-	encodeSearch, err := encode(StringBuilder(d.Config.PlaceholderPrefix, search, d.Config.PlaceholderSuffix))
+// replacement 一个键的替换内容
+type replacement struct {
+	key    string   // 原始的键
+	search string   // 编码后的占位符
+	value  string   // 编码后的替换文本，富文本时为不带格式的文本
+	rich   RichText // 不为 nil 时替换为富文本
+}
+
+// newReplacement 生成将键 key 的占位符替换为 value 的 replacement，rich 不为 nil 时替换为富文本
+func (d *Docx) newReplacement(key, value string, rich RichText) (replacement, error) {
+	search, err := encode(StringBuilder(d.Config.PlaceholderPrefix, key, d.Config.PlaceholderSuffix))
 	if err != nil {
-		return err
+		return replacement{}, err
 	}
-
-	encodeReplace, err := encode(replace)
+	value, err = encode(value)
 	if err != nil {
-		return err
+		return replacement{}, err
+	}
+	return replacement{key: key, search: search, value: value, rich: rich}, nil
+}
+
+// recordKey 记录键是否匹配了占位符，之后再次匹配成功时不再视为未使用
+func (d *Docx) recordKey(key string, n int) {
+	if n == 0 {
+		d.unusedKeys[key] = true
+	} else {
+		delete(d.unusedKeys, key)
 	}
-	d.setValueForPart(encodeSearch, encodeReplace, limit)
-	return nil
 }
 
 func encode(s string) (string, error) {
@@ -340,18 +493,144 @@ func encode(s string) (string, error) {
 	return output, nil
 }
 
-func (d *Docx) setValueForPart(search, replace string, limit int) {
-	if limit <= 0 {
-		limit = -1
+// replaceAll 在主体、页眉、页脚、脚注和尾注的文本中替换 reps 的占位符，返回每个键替换的次数
+// 每个部件只解析一次，属性值不做替换
+func (d *Docx) replaceAll(reps []replacement) ([]int, error) {
+	counts := make([]int, len(reps))
+	err := d.updateTrees(func(_ string, root *node) (bool, error) {
+		return replaceInTree(root, reps, counts), nil
+	})
+	return counts, err
+}
+
+// replaceInTree 在文档树的文本节点中替换 reps 的占位符并累计 counts，返回是否有修改
+func replaceInTree(root *node, reps []replacement, counts []int) bool {
+	queue := root.findAll(func(c *node) bool {
+		if c.typ != textNode {
+			return false
+		}
+		for _, rep := range reps {
+			if strings.Contains(c.text, rep.search) {
+				return true
+			}
+		}
+		return false
+	})
+	changed := len(queue) > 0
+	// 富文本拆分出的文本节点可能还包含其他键的占位符，放回队列继续处理
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = append(queue[1:], replaceText(t, reps, counts)...)
 	}
-	d.MainPart = strings.Replace(d.MainPart, search, replace, limit)
+	return changed
+}
 
+// replaceText 替换文本节点 t 中的占位符并累计 counts，返回富文本替换后拆分出的文本节点
+func replaceText(t *node, reps []replacement, counts []int) []*node {
+	for i, rep := range reps {
+		if rep.rich == nil || !strings.Contains(t.text, rep.search) {
+			continue
+		}
+		n := strings.Count(t.text, rep.search)
+		if texts, ok := setRichText(t, rep.search, rep.rich); ok {
+			counts[i] += n
+			return texts
+		}
+	}
+	// 不在 run 中的富文本占位符替换为不带格式的文本
+	raw := t.text
+	for i, rep := range reps {
+		if n := strings.Count(raw, rep.search); n > 0 {
+			counts[i] += n
+			raw = strings.Replace(raw, rep.search, rep.value, -1)
+		}
+	}
+	if raw != t.text {
+		setRawText(t, raw)
+	}
+	return nil
+}
+
+// setRawText 设置文本节点的原始内容，w:t 中的 <w:br/> 拆分为 w:t、w:br、w:t 兄弟元素
+func setRawText(t *node, raw string) {
+	wt := t.parent
+	if !strings.Contains(raw, "<w:br/>") || wt == nil || wt.name != "w:t" || len(wt.children) != 1 {
+		t.text = strings.Replace(raw, "<w:br/>", "&#xA;", -1)
+		return
+	}
+	var nodes []*node
+	for i, piece := range strings.Split(raw, "<w:br/>") {
+		if i > 0 {
+			nodes = append(nodes, &node{typ: elementNode, name: "w:br", open: "<w:br/>"})
+		}
+		e := newTextElement(wt, piece)
+		if !strings.Contains(e.open, "xml:space") {
+			e.open = `<w:t xml:space="preserve">`
+		}
+		nodes = append(nodes, e)
+	}
+	wt.replaceWith(nodes...)
+}
+
+// eachPart 依次读取主体、页眉、页脚、脚注和尾注，不修改部件，f 返回错误时停止
+func (d *Docx) eachPart(f func(partName, content string) error) error {
+	if err := f(d.MainPartName, d.MainPart); err != nil {
+		return err
+	}
 	for headerIndex, header := range d.Headers {
-		d.Headers[headerIndex] = strings.Replace(header, search, replace, limit)
+		if err := f(getHeaderName(headerIndex), header); err != nil {
+			return err
+		}
 	}
 	for footerIndex, footer := range d.Footers {
-		d.Footers[footerIndex] = strings.Replace(footer, search, replace, limit)
+		if err := f(getFooterName(footerIndex), footer); err != nil {
+			return err
+		}
 	}
+	if d.Footnotes != "" {
+		if err := f(getFootnotesName(), d.Footnotes); err != nil {
+			return err
+		}
+	}
+	if d.Endnotes != "" {
+		if err := f(getEndnotesName(), d.Endnotes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateParts 依次处理主体、页眉、页脚、脚注和尾注，f 接收部件文件名与内容并返回新内容
+func (d *Docx) updateParts(f func(partName, content string) (string, error)) error {
+	s, err := f(d.MainPartName, d.MainPart)
+	if err != nil {
+		return err
+	}
+	d.MainPart = s
+
+	for headerIndex, header := range d.Headers {
+		if s, err = f(getHeaderName(headerIndex), header); err != nil {
+			return err
+		}
+		d.Headers[headerIndex] = s
+	}
+	for footerIndex, footer := range d.Footers {
+		if s, err = f(getFooterName(footerIndex), footer); err != nil {
+			return err
+		}
+		d.Footers[footerIndex] = s
+	}
+	if d.Footnotes != "" {
+		if d.Footnotes, err = f(getFootnotesName(), d.Footnotes); err != nil {
+			return err
+		}
+	}
+	if d.Endnotes != "" {
+		if d.Endnotes, err = f(getEndnotesName(), d.Endnotes); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *ZipBuffer) readPartWithRels(fileName string) string {
@@ -390,6 +669,17 @@ func (b *ZipBuffer) getTempDocumentHeaders(relations map[string]string) map[int]
 	return headers
 }
 
+// getTempDocumentPart 读取可选的部件 (如脚注)，存在关系文件时一并读取
+func (b *ZipBuffer) getTempDocumentPart(name string, relations map[string]string) string {
+	content := b.getFromName(name)
+	if content != "" {
+		if rels := b.readPartWithRels(name); rels != "" {
+			relations[name] = rels
+		}
+	}
+	return content
+}
+
 func (b *ZipBuffer) getTempDocumentMainPart(relations map[string]string) (name, s string) {
 	mainPartName := b.getMainPartName()
 	relations[mainPartName] = b.readPartWithRels(mainPartName)
@@ -421,13 +711,18 @@ func (b *ZipBuffer) getTempDocumentSettingsPart(relations map[string]string) (na
 
 }
 
+// 部件的关系文件名，如 word/header1.xml => word/_rels/header1.xml.rels
 func getRelationsName(s string) string {
-	return StringBuilder("word/_rels/", filepath.Base(s), ".rels")
+	return path.Join(path.Dir(s), "_rels", path.Base(s)+".rels")
 }
 
-// word/_rels/aaa.xml.rels
+// 关系文件所属的部件名，如 word/_rels/aaa.xml.rels => word/aaa.xml，不是关系文件时原样返回
 func getRemoveRelationsName(s string) string {
-	return strReplace([]string{"_rels/", ".rels"}, []string{"", ""}, s)
+	dir, name := path.Split(s)
+	if path.Base(dir) != "_rels" || !strings.HasSuffix(name, ".rels") || name == ".rels" {
+		return s
+	}
+	return path.Join(path.Dir(path.Clean(dir)), strings.TrimSuffix(name, ".rels"))
 }
 
 // 定位位置
@@ -474,6 +769,26 @@ func getFooterName(index int) string {
 	return fmt.Sprintf("word/footer%d.xml", index)
 }
 
+// 脚注名
+func getFootnotesName() string {
+	return "word/footnotes.xml"
+}
+
+// 尾注名
+func getEndnotesName() string {
+	return "word/endnotes.xml"
+}
+
+// 样式名
+func getStylesName() string {
+	return "word/styles.xml"
+}
+
+// 编号名
+func getNumberingName() string {
+	return "word/numbering.xml"
+}
+
 // setting名
 func getSettingsPartName() string {
 	return "word/settings.xml"
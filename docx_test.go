@@ -1,6 +1,9 @@
 package docx
 
 import (
+	"archive/zip"
+	"bytes"
+	"fmt"
 	"os"
 	"testing"
 )
@@ -47,3 +50,56 @@ func TestDocx(t *testing.T) {
 		t.Errorf("Buffer 长度为 0")
 	}
 }
+
+// testDocumentTpl 测试用文档主体模板
+const testDocumentTpl = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"><w:body>%s</w:body></w:document>`
+
+// newTestDocx 在内存中构造只包含给定正文的文档
+func newTestDocx(t *testing.T, body string) *Docx {
+	return newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, body),
+	})
+}
+
+// newTestDocxWithParts 在内存中构造包含给定部件的文档
+func newTestDocxWithParts(t *testing.T, parts map[string]string) *Docx {
+	t.Helper()
+	files := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="xml" ContentType="application/xml"/><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`,
+		"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`,
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`,
+	}
+	for name, content := range parts {
+		files[name] = content
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), DefaultConfig)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	return doc
+}
+
+// testParagraph 构造只包含一段文本的段落
+func testParagraph(text string) string {
+	return `<w:p><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+}
@@ -0,0 +1,147 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// isOpenTag 判断 content[i:] 是否为 tag 的开始标签 (如 <w:p> 或 <w:p w:rsidR="..">)
+func isOpenTag(content string, i int, tag string) bool {
+	if !strings.HasPrefix(content[i:], "<"+tag) {
+		return false
+	}
+	j := i + len(tag) + 1
+	if j >= len(content) {
+		return false
+	}
+	switch content[j] {
+	case '>', '/', ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// findElement 查找包含 pos 的最内层 tag 元素，返回 [start, end)
+// 与 LastIndex 的方式不同，这里会处理同名元素的嵌套 (如嵌套表格)
+// 未找到时返回 -1, -1
+func findElement(content string, pos int, tag string) (start, end int) {
+	closeTag := "</" + tag + ">"
+	var stack []int
+	for i := 0; i < len(content); {
+		j := strings.IndexByte(content[i:], '<')
+		if j == -1 {
+			break
+		}
+		i += j
+		if i > pos && len(stack) == 0 {
+			break
+		}
+		switch {
+		case strings.HasPrefix(content[i:], closeTag):
+			e := i + len(closeTag)
+			if n := len(stack); n > 0 {
+				s := stack[n-1]
+				stack = stack[:n-1]
+				if s <= pos && pos < e {
+					return s, e
+				}
+			}
+			i = e
+		case isOpenTag(content, i, tag):
+			gt := strings.IndexByte(content[i:], '>')
+			if gt == -1 {
+				return -1, -1
+			}
+			if content[i+gt-1] != '/' {
+				stack = append(stack, i)
+			}
+			i += gt + 1
+		default:
+			i++
+		}
+	}
+	return -1, -1
+}
+
+// findElements 查找 content 中所有最外层的 tag 元素，返回各自的 [start, end)，自闭合元素不计入
+func findElements(content, tag string) [][2]int {
+	var res [][2]int
+	closeTag := "</" + tag + ">"
+	depth, start := 0, 0
+	for i := 0; i < len(content); {
+		j := strings.IndexByte(content[i:], '<')
+		if j == -1 {
+			break
+		}
+		i += j
+		switch {
+		case strings.HasPrefix(content[i:], closeTag):
+			i += len(closeTag)
+			if depth > 0 {
+				depth--
+				if depth == 0 {
+					res = append(res, [2]int{start, i})
+				}
+			}
+		case isOpenTag(content, i, tag):
+			gt := strings.IndexByte(content[i:], '>')
+			if gt == -1 {
+				return res
+			}
+			if content[i+gt-1] != '/' {
+				if depth == 0 {
+					start = i
+				}
+				depth++
+			}
+			i += gt + 1
+		default:
+			i++
+		}
+	}
+	return res
+}
+
+// stripTags 去除所有 XML 标签，仅保留文本
+func stripTags(s string) string {
+	var sb strings.Builder
+	inTag := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '<':
+			inTag = true
+		case s[i] == '>':
+			inTag = false
+		case !inTag:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// escapeText 转义 XML 文本
+func escapeText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// textRun 生成一个文本 run，换行符转换为 <w:br/>，rPr 为 run 的格式 (可为空)
+func textRun(text, rPr string) string {
+	var sb strings.Builder
+	sb.WriteString(`<w:r>`)
+	if rPr != "" {
+		sb.WriteString(`<w:rPr>` + rPr + `</w:rPr>`)
+	}
+	for i, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if i > 0 {
+			sb.WriteString(`<w:br/>`)
+		}
+		if line != "" {
+			sb.WriteString(`<w:t xml:space="preserve">` + escapeText(line) + `</w:t>`)
+		}
+	}
+	sb.WriteString(`</w:r>`)
+	return sb.String()
+}
@@ -0,0 +1,577 @@
+package docx
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+SetHTML 将标记所在的段落替换为 HTML 片段转换得到的段落、表格
+
+	模板: {{html:content}}
+	doc.SetHTML("html:content", `<h1>Title</h1><p>Hello <b>World</b></p>`)
+
+支持的标签:
+
+	p、div、h1-h6、blockquote、pre、hr、br
+	b/strong、i/em、u、s/del、sup、sub、code、mark、span、font、a
+	ul、ol (可嵌套，start 属性)、li
+	table、thead、tbody、tr、th、td (colspan)
+	img (仅 data URI，width、height 属性为像素)
+
+style 属性支持 color、background-color、font-weight、font-style、text-decoration、
+font-size、font-family、vertical-align、text-align，其他标签按内容处理，script、style 被忽略。
+多余或交错的结束标签会被容错处理，文本中单独的 < 按字符输出
+*/
+func (d *Docx) SetHTML(mark, html string) error {
+	blocks, err := htmlBlocks(html)
+	if err != nil {
+		return err
+	}
+	return d.replaceParagraphs(mark, blocks)
+}
+
+// htmlNode 解析后的 HTML 元素或文本
+type htmlNode struct {
+	tag      string // 小写的标签名，文本为空
+	attrs    map[string]string
+	text     string
+	children []*htmlNode
+}
+
+// htmlRootTag 包裹片段的根元素，使未闭合的标签在结尾自动闭合
+const htmlRootTag = "docx-html"
+
+// htmlVoidTags 没有结束标签的元素
+var htmlVoidTags = make(map[string]bool)
+
+func init() {
+	for _, tag := range xml.HTMLAutoClose {
+		htmlVoidTags[tag] = true
+	}
+}
+
+// htmlBareLtReg 不是标签开头的 <，如 1 < 2
+var htmlBareLtReg = regexp.MustCompile(`<(?:[^a-zA-Z/!?]|/[^a-zA-Z]|/?$)`)
+
+// parseHTML 使用非严格模式的 encoding/xml 解析 HTML 片段
+/*
+	结束标签按名称关闭最近的同名元素及其中未闭合的元素，没有对应的元素时忽略，
+	因此 <b><i>x</b></i>、<p>x</p></p> 也能解析，文本中单独的 < 按字符处理
+*/
+func parseHTML(s string) (*htmlNode, error) {
+	s = htmlBareLtReg.ReplaceAllStringFunc(s, func(m string) string {
+		return "&lt;" + m[1:]
+	})
+	dec := xml.NewDecoder(strings.NewReader("<" + htmlRootTag + ">" + s + "</" + htmlRootTag + ">"))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	root := &htmlNode{tag: htmlRootTag}
+	stack := []*htmlNode{root}
+	for {
+		// RawToken 不检查开始与结束标签是否匹配，由下面按名称处理
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("docx: invalid html: %w", err)
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			tag := htmlTagName(t.Name)
+			n := &htmlNode{tag: tag, attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				n.attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			top.children = append(top.children, n)
+			if !htmlVoidTags[tag] {
+				stack = append(stack, n)
+			}
+		case xml.EndElement:
+			tag := htmlTagName(t.Name)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == tag {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			top.children = append(top.children, &htmlNode{text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// htmlTagName 返回小写的标签名，带前缀时为 前缀:名称
+func htmlTagName(name xml.Name) string {
+	tag := strings.ToLower(name.Local)
+	if name.Space != "" {
+		tag = strings.ToLower(name.Space) + ":" + tag
+	}
+	return tag
+}
+
+// htmlBlocks 将 HTML 片段转换为块
+func htmlBlocks(s string) ([]contentBlock, error) {
+	root, err := parseHTML(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &htmlConverter{}
+	return c.blocks(root.children, htmlContext{}), nil
+}
+
+// htmlInlineTags 行内标签，其余标签按块处理
+var htmlInlineTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "big": true, "br": true, "cite": true, "code": true, "del": true,
+	"em": true, "font": true, "i": true, "img": true, "ins": true, "kbd": true, "mark": true, "q": true,
+	"s": true, "samp": true, "small": true, "span": true, "strike": true, "strong": true, "sub": true,
+	"sup": true, "tt": true, "u": true, "var": true, "label": true,
+}
+
+// htmlIgnoredTags 内容不输出的标签
+var htmlIgnoredTags = map[string]bool{"script": true, "style": true, "head": true, "title": true, "template": true}
+
+var htmlSpaceReg = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// htmlContext 从外层元素继承的格式
+type htmlContext struct {
+	format TextSegment  // 文字格式，Text 不使用
+	style  string       // 字符样式的名称
+	link   string       // 超链接地址
+	para   contentBlock // 新段落的模板 (样式、列表、缩进、对齐)
+	pre    bool         // 保留空白
+}
+
+// htmlConverter 将 HTML 节点转换为块
+type htmlConverter struct {
+	lists int // 已分配的列表 id
+}
+
+// blocks 转换一组兄弟节点，连续的文本与行内元素组成一个段落
+func (c *htmlConverter) blocks(nodes []*htmlNode, ctx htmlContext) []contentBlock {
+	var res []contentBlock
+	var cur *contentBlock
+	flush := func() {
+		if cur != nil && trimRuns(cur, ctx.pre) {
+			res = append(res, *cur)
+		}
+		cur = nil
+	}
+	for _, n := range nodes {
+		if htmlIgnoredTags[n.tag] {
+			continue
+		}
+		if n.tag == "" || htmlInlineTags[n.tag] {
+			if cur == nil {
+				p := ctx.para
+				cur = &p
+			}
+			c.inline(cur, n, ctx)
+			continue
+		}
+		flush()
+		res = append(res, c.block(n, ctx)...)
+	}
+	flush()
+	return res
+}
+
+// trimRuns 删除段落首尾的空白，返回段落是否还有内容
+func trimRuns(p *contentBlock, pre bool) bool {
+	if !pre {
+		for i := len(p.runs) - 1; i >= 0 && p.runs[i].image == nil; i-- {
+			p.runs[i].Text = strings.TrimRight(p.runs[i].Text, " ")
+			if p.runs[i].Text != "" {
+				break
+			}
+			p.runs = p.runs[:i]
+		}
+	}
+	return len(p.runs) > 0
+}
+
+// block 转换块级元素
+func (c *htmlConverter) block(n *htmlNode, ctx htmlContext) []contentBlock {
+	ctx.para.runs = nil
+	applyCSS(&ctx.format, n.attrs["style"])
+	if align := htmlAlign(n); align != "" {
+		ctx.para.align = align
+	}
+	switch n.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		ctx.para.style = "heading " + n.tag[1:]
+		return c.paragraph(n, ctx)
+	case "p":
+		return c.paragraph(n, ctx)
+	case "blockquote":
+		if ctx.para.style == "Quote" {
+			ctx.para.indent += listIndent
+		}
+		ctx.para.style = "Quote"
+		return c.blocks(n.children, ctx)
+	case "pre":
+		ctx.para.style = "HTML Preformatted"
+		ctx.pre = true
+		// 紧跟 <pre> 的换行不属于内容
+		if len(n.children) > 0 && n.children[0].tag == "" {
+			n.children[0].text = strings.TrimPrefix(strings.TrimPrefix(n.children[0].text, "\r"), "\n")
+		}
+		return c.paragraph(n, ctx)
+	case "hr":
+		p := ctx.para
+		p.rule = true
+		return []contentBlock{p}
+	case "ul", "ol":
+		return c.list(n, ctx)
+	case "table":
+		return []contentBlock{c.table(n, ctx)}
+	}
+	return c.blocks(n.children, ctx)
+}
+
+// paragraph 转换段落元素，没有内容时保留一个空段落
+func (c *htmlConverter) paragraph(n *htmlNode, ctx htmlContext) []contentBlock {
+	res := c.blocks(n.children, ctx)
+	if len(res) == 0 {
+		res = append(res, ctx.para)
+	}
+	return res
+}
+
+// list 转换 ul、ol，每个 li 的第一个段落带编号，其余段落与编号文字对齐
+func (c *htmlConverter) list(n *htmlNode, ctx htmlContext) []contentBlock {
+	c.lists++
+	item := listItem{id: c.lists, ordered: n.tag == "ol"}
+	if ctx.para.list != nil {
+		item.level = ctx.para.list.level + 1
+	}
+	if item.ordered {
+		item.start, _ = strconv.Atoi(n.attrs["start"])
+	}
+
+	var res []contentBlock
+	for _, li := range n.children {
+		if li.tag != "li" {
+			continue
+		}
+		liCtx := ctx
+		it := item
+		liCtx.para.list = &it
+		liCtx.para.style = ""
+		first := true
+		for _, b := range c.blocks(li.children, liCtx) {
+			if b.list == &it {
+				if !first {
+					b.list = nil
+					b.indent = listIndent * (it.level + 1)
+				}
+				first = false
+			}
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// table 转换表格，thead 中的行或全部为 th 的开头行作为表头
+func (c *htmlConverter) table(n *htmlNode, ctx htmlContext) contentBlock {
+	t := &contentTable{}
+	cellCtx := htmlContext{format: ctx.format, style: ctx.style}
+	var visit func(n *htmlNode, head bool)
+	visit = func(n *htmlNode, head bool) {
+		for _, child := range n.children {
+			switch child.tag {
+			case "thead":
+				visit(child, true)
+			case "tbody", "tfoot":
+				visit(child, false)
+			case "tr":
+				var row []contentCell
+				allTh := true
+				for _, td := range child.children {
+					if td.tag != "td" && td.tag != "th" {
+						continue
+					}
+					tdCtx := cellCtx
+					tdCtx.para.align = htmlAlign(td)
+					if td.tag == "th" {
+						tdCtx.format.Bold = true
+					} else {
+						allTh = false
+					}
+					span, _ := strconv.Atoi(td.attrs["colspan"])
+					row = append(row, contentCell{span: span, blocks: c.blocks(td.children, tdCtx)})
+				}
+				if (head || allTh && len(row) > 0) && len(t.rows) == t.header {
+					t.header++
+				}
+				t.rows = append(t.rows, row)
+			}
+		}
+	}
+	visit(n, false)
+	return contentBlock{table: t}
+}
+
+// inline 将文本或行内元素添加到段落 p
+func (c *htmlConverter) inline(p *contentBlock, n *htmlNode, ctx htmlContext) {
+	if n.tag == "" {
+		text := n.text
+		if !ctx.pre {
+			text = htmlSpaceReg.ReplaceAllString(text, " ")
+			if last := len(p.runs) - 1; last == -1 || strings.HasSuffix(p.runs[last].Text, " ") || strings.HasSuffix(p.runs[last].Text, "\n") {
+				text = strings.TrimLeft(text, " ")
+			}
+		}
+		addText(p, inlineRun{TextSegment: ctx.format, style: ctx.style, link: ctx.link}, text)
+		return
+	}
+
+	switch n.tag {
+	case "br":
+		addText(p, inlineRun{TextSegment: ctx.format, style: ctx.style, link: ctx.link}, "\n")
+		return
+	case "img":
+		c.image(p, n, ctx)
+		return
+	case "b", "strong":
+		ctx.format.Bold = true
+	case "i", "em", "cite", "var":
+		ctx.format.Italic = true
+	case "u", "ins":
+		ctx.format.Underline = true
+	case "s", "strike", "del":
+		ctx.format.Strike = true
+	case "sup":
+		ctx.format.Superscript, ctx.format.Subscript = true, false
+	case "sub":
+		ctx.format.Subscript, ctx.format.Superscript = true, false
+	case "code", "kbd", "tt", "samp":
+		ctx.style = "HTML Code"
+	case "mark":
+		ctx.format.Highlight = "yellow"
+	case "a":
+		if href := strings.TrimSpace(n.attrs["href"]); href != "" {
+			ctx.link = href
+		}
+	case "font":
+		if color := parseColor(n.attrs["color"]); color != "" {
+			ctx.format.Color = color
+		}
+		if face := n.attrs["face"]; face != "" {
+			ctx.format.Font = strings.TrimSpace(strings.Split(face, ",")[0])
+		}
+	}
+	applyCSS(&ctx.format, n.attrs["style"])
+	for _, child := range n.children {
+		if !htmlIgnoredTags[child.tag] {
+			c.inline(p, child, ctx)
+		}
+	}
+}
+
+// addText 添加文字，格式与上一段相同时合并
+func addText(p *contentBlock, run inlineRun, text string) {
+	if text == "" {
+		return
+	}
+	if last := len(p.runs) - 1; last >= 0 {
+		prev := p.runs[last]
+		prev.Text = ""
+		if prev == run {
+			p.runs[last].Text += text
+			return
+		}
+	}
+	run.Text = text
+	p.runs = append(p.runs, run)
+}
+
+// image 添加 data URI 图片，无法读取时以替代文本代替
+func (c *htmlConverter) image(p *contentBlock, n *htmlNode, ctx htmlContext) {
+	alt := n.attrs["alt"]
+	img, err := dataURIImage(n.attrs["src"])
+	if err != nil {
+		addText(p, inlineRun{TextSegment: ctx.format, style: ctx.style, link: ctx.link}, alt)
+		return
+	}
+	width, height := htmlPixels(n.attrs["width"]), htmlPixels(n.attrs["height"])
+	switch {
+	case img.Width <= 0 || img.Height <= 0:
+		if width > 0 && height > 0 {
+			img.Width, img.Height = width, height
+		}
+	case width > 0 && height > 0:
+		img.Width, img.Height = width, height
+	case width > 0:
+		img.Width, img.Height = width, img.Height*width/img.Width
+	case height > 0:
+		img.Width, img.Height = img.Width*height/img.Height, height
+	}
+	img.Description, img.Title = alt, n.attrs["title"]
+	p.runs = append(p.runs, inlineRun{link: ctx.link, image: &img})
+}
+
+// dataURIImage 解码 data:[<mime>][;base64],<data> 形式的图片
+func dataURIImage(src string) (ImgValue, error) {
+	src = strings.TrimSpace(src)
+	comma := strings.IndexByte(src, ',')
+	if !strings.HasPrefix(src, "data:") || comma == -1 {
+		return ImgValue{}, fmt.Errorf("%w: not a data uri", ErrUnsupportedImage)
+	}
+	meta, payload := src[len("data:"):comma], src[comma+1:]
+	var data []byte
+	var err error
+	if strings.HasSuffix(meta, ";base64") {
+		data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	} else {
+		var s string
+		s, err = url.PathUnescape(payload)
+		data = []byte(s)
+	}
+	if err != nil {
+		return ImgValue{}, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	img, err := ImageFromBytes(data)
+	if err == nil && img.Type == "svg" {
+		// data URI 无法同时提供栅格替代图
+		return ImgValue{}, ErrSVGFallbackRequired
+	}
+	return img, err
+}
+
+// htmlPixels 解析像素值，如 120、120px
+func htmlPixels(s string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// htmlAlign 返回 align 属性或 text-align 样式对应的 w:jc 值
+func htmlAlign(n *htmlNode) string {
+	align := n.attrs["align"]
+	for _, decl := range strings.Split(n.attrs["style"], ";") {
+		if kv := strings.SplitN(decl, ":", 2); len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "text-align") {
+			align = kv[1]
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(align)) {
+	case "left", "start":
+		return "left"
+	case "center":
+		return "center"
+	case "right", "end":
+		return "right"
+	case "justify":
+		return "both"
+	}
+	return ""
+}
+
+// applyCSS 将 style 属性中的文字格式应用到 f
+func applyCSS(f *TextSegment, style string) {
+	for _, decl := range strings.Split(style, ";") {
+		kv := strings.SplitN(decl, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(kv[1]), "!important"))
+		lower := strings.ToLower(value)
+		switch key {
+		case "color":
+			if color := parseColor(value); color != "" {
+				f.Color = color
+			}
+		case "background-color", "background":
+			if h := highlightColor(parseColor(value)); h != "" {
+				f.Highlight = h
+			}
+		case "font-weight":
+			weight, _ := strconv.Atoi(lower)
+			f.Bold = lower == "bold" || lower == "bolder" || weight >= 600
+		case "font-style":
+			f.Italic = lower == "italic" || lower == "oblique"
+		case "text-decoration", "text-decoration-line":
+			f.Underline = strings.Contains(lower, "underline")
+			f.Strike = strings.Contains(lower, "line-through")
+		case "font-size":
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(lower, "pt"), 64); err == nil && strings.HasSuffix(lower, "pt") {
+				f.Size = v
+			} else if v, err := strconv.ParseFloat(strings.TrimSuffix(lower, "px"), 64); err == nil && strings.HasSuffix(lower, "px") {
+				f.Size = v * 72 / 96
+			}
+		case "font-family":
+			f.Font = strings.Trim(strings.TrimSpace(strings.Split(value, ",")[0]), `"'`)
+		case "vertical-align":
+			f.Superscript, f.Subscript = lower == "super", lower == "sub"
+		}
+	}
+}
+
+// htmlColors 常用的颜色名称
+var htmlColors = map[string]string{
+	"black": "000000", "white": "FFFFFF", "red": "FF0000", "lime": "00FF00", "green": "008000", "blue": "0000FF",
+	"yellow": "FFFF00", "cyan": "00FFFF", "aqua": "00FFFF", "magenta": "FF00FF", "fuchsia": "FF00FF",
+	"gray": "808080", "grey": "808080", "silver": "C0C0C0", "maroon": "800000", "olive": "808000",
+	"navy": "000080", "purple": "800080", "teal": "008080", "orange": "FFA500",
+}
+
+// parseColor 将 #rgb、#rrggbb、rgb(r, g, b) 或颜色名称转换为 RRGGBB，无法识别时为空
+func parseColor(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if hex, ok := htmlColors[s]; ok {
+		return hex
+	}
+	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") {
+		parts := strings.Split(s[4:len(s)-1], ",")
+		if len(parts) != 3 {
+			return ""
+		}
+		var hex strings.Builder
+		for _, p := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || v < 0 || v > 255 {
+				return ""
+			}
+			fmt.Fprintf(&hex, "%02X", v)
+		}
+		return hex.String()
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(s, 16, 32); err != nil {
+		return ""
+	}
+	return strings.ToUpper(s)
+}
+
+// highlightColors Word 突出显示支持的颜色 (白色视为无突出显示)
+var highlightColors = map[string]string{
+	"FFFF00": "yellow", "00FF00": "green", "00FFFF": "cyan", "FF00FF": "magenta", "0000FF": "blue",
+	"FF0000": "red", "000080": "darkBlue", "008080": "darkCyan", "008000": "darkGreen",
+	"800080": "darkMagenta", "800000": "darkRed", "808000": "darkYellow", "808080": "darkGray",
+	"C0C0C0": "lightGray", "000000": "black",
+}
+
+// highlightColor 返回颜色对应的突出显示名称，不支持的颜色为空
+func highlightColor(hex string) string {
+	return highlightColors[hex]
+}
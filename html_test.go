@@ -0,0 +1,152 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:style w:type="paragraph" w:styleId="1"><w:name w:val="heading 1"/></w:style></w:styles>`
+
+func TestSetHTML(t *testing.T) {
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{html}}`)+testParagraph(`end`)),
+		"word/styles.xml":   testStyles,
+	})
+	defer doc.Close()
+
+	html := `<h1>Title</h1>
+<h2 style="text-align:center">Sub</h2>
+<p>Hello <b>bold <i>both</i></b>, <span style="color:#f00; font-size:12pt">red</span>
+ and <a href="https://example.com/?a=1&amp;b=2">link</a><br>next line</p>
+<ul><li>one<ul><li>nested</li></ul></li><li>two</li></ul>
+<ol start="3"><li>three</li></ol>
+<blockquote>quoted</blockquote>
+<pre>
+a  b</pre>
+<p>x<sup>2</sup> <code>code</code> <mark>hi</mark></p>
+<hr>
+<script>alert(1)</script>`
+	if err := doc.SetHTML("html", html); err != nil {
+		t.Fatalf("插入 HTML 失败: %v", err)
+	}
+
+	for _, want := range []string{
+		`<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t xml:space="preserve">Title</w:t></w:r></w:p>`,
+		`<w:pPr><w:pStyle w:val="Heading2"/><w:jc w:val="center"/></w:pPr>`,
+		`<w:r><w:t xml:space="preserve">Hello </w:t></w:r><w:r><w:rPr><w:b/><w:bCs/></w:rPr><w:t xml:space="preserve">bold </w:t></w:r>` +
+			`<w:r><w:rPr><w:b/><w:bCs/><w:i/><w:iCs/></w:rPr><w:t xml:space="preserve">both</w:t></w:r>`,
+		`<w:rPr><w:color w:val="FF0000"/><w:sz w:val="24"/><w:szCs w:val="24"/></w:rPr><w:t xml:space="preserve">red</w:t>`,
+		`<w:hyperlink xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:id="rId1" w:history="1"><w:r><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr><w:t xml:space="preserve">link</w:t></w:r></w:hyperlink>`,
+		`<w:t xml:space="preserve">next line</w:t>`,
+		`<w:br/>`,
+		`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">one</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">nested</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">two</w:t></w:r></w:p>`,
+		`<w:numId w:val="3"/>`,
+		`<w:pStyle w:val="Quote"/></w:pPr><w:r><w:t xml:space="preserve">quoted</w:t>`,
+		`<w:pStyle w:val="HTMLPreformatted"/></w:pPr><w:r><w:t xml:space="preserve">a  b</w:t>`,
+		`<w:rPr><w:vertAlign w:val="superscript"/></w:rPr><w:t xml:space="preserve">2</w:t>`,
+		`<w:rPr><w:rStyle w:val="HTMLCode"/></w:rPr><w:t xml:space="preserve">code</w:t>`,
+		`<w:rPr><w:highlight w:val="yellow"/></w:rPr><w:t xml:space="preserve">hi</w:t>`,
+		`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `{{html}}`) || strings.Contains(doc.MainPart, `alert`) {
+		t.Errorf("占位符段落应被替换，script 应被忽略: %s", doc.MainPart)
+	}
+
+	rels := doc.Relations["word/document.xml"]
+	if !strings.Contains(rels, `Target="https://example.com/?a=1&amp;b=2" TargetMode="External"/>`) || !strings.Contains(rels, `Target="numbering.xml"`) {
+		t.Errorf("应登记超链接与编号关系: %s", rels)
+	}
+	if !strings.Contains(doc.ContentTypes, `<Override PartName="/word/numbering.xml"`) {
+		t.Errorf("应登记 numbering.xml 的内容类型: %s", doc.ContentTypes)
+	}
+	numbering := doc.part(getNumberingName())
+	if strings.Count(numbering, `<w:abstractNum `) != 3 || strings.Index(numbering, `<w:num `) < strings.LastIndex(numbering, `</w:abstractNum>`) ||
+		!strings.Contains(numbering, `<w:startOverride w:val="3"/>`) {
+		t.Errorf("编号定义错误: %s", numbering)
+	}
+	styles := doc.part(getStylesName())
+	if !strings.Contains(styles, `w:styleId="Heading2"`) || !strings.Contains(styles, `w:styleId="Quote"`) || strings.Contains(styles, `w:styleId="Heading1"`) {
+		t.Errorf("应只添加模板中缺少的样式: %s", styles)
+	}
+
+	buf, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if !strings.Contains(saved.ZipBuffer.getFromName("word/numbering.xml"), `<w:numbering`) {
+		t.Error("保存时应写入新增的 numbering.xml")
+	}
+}
+
+func TestSetHTMLTableAndImage(t *testing.T) {
+	doc := newTestDocx(t, `<w:tbl><w:tr><w:tc>`+testParagraph(`{{html}}`)+`</w:tc></w:tr></w:tbl>`)
+	defer doc.Close()
+
+	data, err := ioutil.ReadFile(testImage(t, "chart.png", 40, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png := base64.StdEncoding.EncodeToString(data)
+	html := `<table><thead><tr><th>Name</th><th>Score</th></tr></thead>` +
+		`<tr><td colspan="2" align="right">A &amp; B</td></tr><tr><td>x</td></tr></table>` +
+		`<img src="data:image/png;base64,` + png + `" width="80" alt="chart"><img src="missing.png" alt="fallback">`
+	if err = doc.SetHTML("html", html); err != nil {
+		t.Fatalf("插入 HTML 失败: %v", err)
+	}
+
+	for _, want := range []string{
+		`<w:gridCol w:w="4500"/><w:gridCol w:w="4500"/>`,
+		`<w:tr><w:trPr><w:tblHeader/></w:trPr><w:tc><w:tcPr><w:tcW w:w="4500" w:type="dxa"/></w:tcPr><w:p><w:r><w:rPr><w:b/><w:bCs/></w:rPr><w:t xml:space="preserve">Name</w:t>`,
+		`<w:tcW w:w="9000" w:type="dxa"/><w:gridSpan w:val="2"/></w:tcPr><w:p><w:pPr><w:jc w:val="right"/></w:pPr><w:r><w:t xml:space="preserve">A &amp; B</w:t>`,
+		`<w:t xml:space="preserve">x</w:t></w:r></w:p></w:tc><w:tc><w:tcPr><w:tcW w:w="4500" w:type="dxa"/></w:tcPr><w:p/></w:tc></w:tr>`,
+		`<wp:extent cx="` + fmt.Sprint(80*emuPerPixel) + `" cy="` + fmt.Sprint(40*emuPerPixel) + `"/>`,
+		`descr="chart"`,
+		`<w:t xml:space="preserve">fallback</w:t></w:r></w:p></w:tc>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if !strings.Contains(doc.Relations["word/document.xml"], `relationships/image"`) {
+		t.Errorf("应登记图片关系: %s", doc.Relations["word/document.xml"])
+	}
+	if _, err = doc.SaveToBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if report := doc.MediaReport(); len(report.Unused) != 0 {
+		t.Errorf("插入的图片不应被当作未引用删除: %+v", report)
+	}
+}
+
+func TestSetHTMLMalformed(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{html}}`))
+	defer doc.Close()
+
+	if err := doc.SetHTML("html", `<p>x</p></p><p><b><i>y</b></i> 1 < 2</div></p>`); err != nil {
+		t.Fatalf("不规范的 HTML 也应能插入: %v", err)
+	}
+	for _, want := range []string{
+		`<w:p><w:r><w:t xml:space="preserve">x</w:t></w:r></w:p>`,
+		`<w:r><w:rPr><w:b/><w:bCs/><w:i/><w:iCs/></w:rPr><w:t xml:space="preserve">y</w:t></w:r><w:r><w:t xml:space="preserve"> 1 &lt; 2</w:t></w:r>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+}
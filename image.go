@@ -2,12 +2,16 @@ package docx
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"image"
 	_ "image/gif" // 检测图片类型
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"regexp"
@@ -20,6 +24,27 @@ var bmpByte = []byte("BM")
 var jpgByte = []byte{0xff, 0xd8, 0xff}
 var pngByte = []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a}
 
+// ridReg 匹配关系文件中 rIdN 形式的 id
+var ridReg = regexp.MustCompile(`\sId="rId(\d+)"`)
+
+// svgTagReg 匹配 SVG 根元素的开始标签
+var svgTagReg = regexp.MustCompile(`<svg\b[^>]*>`)
+
+// emuPerPixel 每像素 (96 DPI) 对应的 EMU
+const emuPerPixel = 9525
+
+// DrawingML 相关命名空间
+const (
+	nsWordprocessingDrawing = "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"
+	nsDrawingML             = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	nsPicture               = "http://schemas.openxmlformats.org/drawingml/2006/picture"
+	nsRelationships         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsSVG                   = "http://schemas.microsoft.com/office/drawing/2016/SVG/main"
+)
+
+// svgBlipExtURI a:blip 中 SVG 扩展的 uri
+const svgBlipExtURI = "{96DAC541-7B7A-43D3-8B79-37D633B846F1}"
+
 // GIFTYPE
 const (
 	GIFTYPE = "image/gif"
@@ -28,14 +53,28 @@ const (
 	PNGTYPE = "image/png"
 )
 
+// ErrUnsupportedImage 无法识别的图片格式
+var ErrUnsupportedImage = errors.New("docx: unsupported image format")
+
+// ErrSVGFallbackRequired SVG 图片没有提供可识别的栅格替代图 (ImgValue.Fallback)
+var ErrSVGFallbackRequired = errors.New("docx: svg image requires a raster fallback")
+
 // ImgValue 结构体
 type ImgValue struct {
-	Path, Type string
-	Width      int
-	Height     int
-	Search     string
-	Replace    string
-	Rid        string
+	Path, Type  string
+	Width       int
+	Height      int
+	Search      string
+	Replace     string
+	Rid         string
+	KeepSize    bool         // ReplaceImage 时保留模板中图片的原尺寸
+	Anchor      *ImageAnchor // 不为空时插入浮动图片，否则为内嵌图片
+	Fallback    []byte       // SVG 图片的栅格替代图 (PNG、JPEG 等)，SVG 图片必须提供
+	Description string       // 替代文本 (wp:docPr descr)，为空时使用文件名
+	Title       string       // 标题 (wp:docPr title)
+	Caption     string       // 不为空时在图片所在段落之后插入 "Figure N: Caption" 题注段落
+
+	data []byte // 内存中的图片数据，为空时从 Path 读取
 }
 
 // SetWidth 设置图片宽度
@@ -52,104 +91,357 @@ func (i ImgValue) SetHeight(height int) ImgValue {
 
 // GetArrangeImage return imgValue
 func (d *Docx) GetArrangeImage(path string) ImgValue {
-	file, err := os.Open(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return ImgValue{}
 	}
-	defer file.Close()
-	imgConfig, t, err := image.DecodeConfig(file)
+	img, err := ImageFromBytes(data)
 	if err != nil {
 		return ImgValue{}
 	}
-	width := imgConfig.Width
-	height := imgConfig.Height
+	img.Path = path
+	img.data = nil // 保存时仍从 Path 读取
+	return img
+}
+
+// ImageAnchor 浮动图片 (wp:anchor) 的位置、环绕方式与叠放次序
+type ImageAnchor struct {
+	Wrap           string // 环绕方式: square (默认)、tight、behind (衬于文字下方)、front (浮于文字上方)
+	HorizontalFrom string // 水平偏移的参照: column (默认)、page、margin、character ...
+	VerticalFrom   string // 垂直偏移的参照: paragraph (默认)、page、margin、line ...
+	OffsetX        int    // 水平偏移，像素
+	OffsetY        int    // 垂直偏移，像素
+	ZOrder         int    // 叠放次序 (relativeHeight)，越大越靠上，为 0 时按插入顺序
+}
+
+// open 生成 wp:anchor 开始标签及位置
+func (a *ImageAnchor) open(id int) string {
+	tpl := `<wp:anchor xmlns:wp="` + nsWordprocessingDrawing + `" distT="0" distB="0" distL="114300" distR="114300" simplePos="0" relativeHeight="{Z}" behindDoc="{BEHIND}" locked="0" layoutInCell="1" allowOverlap="1">` +
+		`<wp:simplePos x="0" y="0"/>` +
+		`<wp:positionH relativeFrom="{H}"><wp:posOffset>{X}</wp:posOffset></wp:positionH>` +
+		`<wp:positionV relativeFrom="{V}"><wp:posOffset>{Y}</wp:posOffset></wp:positionV>`
+
+	z, behind, h, v := a.ZOrder, "0", a.HorizontalFrom, a.VerticalFrom
+	if z <= 0 {
+		z = id
+	}
+	if a.Wrap == "behind" {
+		behind = "1"
+	}
+	if h == "" {
+		h = "column"
+	}
+	if v == "" {
+		v = "paragraph"
+	}
+	return strReplace(
+		[]string{`{Z}`, `{BEHIND}`, `{H}`, `{V}`, `{X}`, `{Y}`},
+		[]string{
+			strconv.Itoa(z),
+			behind,
+			escapeText(h),
+			escapeText(v),
+			strconv.FormatInt(int64(a.OffsetX)*emuPerPixel, 10),
+			strconv.FormatInt(int64(a.OffsetY)*emuPerPixel, 10),
+		},
+		tpl,
+	)
+}
 
+// wrapXML 生成环绕方式，衬于文字下方与浮于文字上方均不环绕
+func (a *ImageAnchor) wrapXML() string {
+	switch a.Wrap {
+	case "behind", "front":
+		return `<wp:wrapNone/>`
+	case "tight":
+		return `<wp:wrapTight wrapText="bothSides"><wp:wrapPolygon edited="0"><wp:start x="0" y="0"/><wp:lineTo x="0" y="21600"/>` +
+			`<wp:lineTo x="21600" y="21600"/><wp:lineTo x="21600" y="0"/><wp:lineTo x="0" y="0"/></wp:wrapPolygon></wp:wrapTight>`
+	}
+	return `<wp:wrapSquare wrapText="bothSides"/>`
+}
+
+// ImageFromBytes 使用内存中的图片数据创建 ImgValue，格式与尺寸由文件头识别
+func ImageFromBytes(data []byte) (ImgValue, error) {
+	t := sniffImageType(data)
+	if t == "" {
+		return ImgValue{}, ErrUnsupportedImage
+	}
+	width, height, err := imageSize(data, t)
+	if err != nil {
+		return ImgValue{}, err
+	}
 	return ImgValue{
-		Path:   path,
+		Type:   t,
 		Width:  width,
 		Height: height,
-		Type:   t,
+		data:   data,
+	}, nil
+}
+
+// ImageFromReader 读取 r 中的全部图片数据创建 ImgValue，适用于 S3、HTTP 等数据流
+func ImageFromReader(r io.Reader) (ImgValue, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ImgValue{}, fmt.Errorf("failed to read image: %w", err)
 	}
+	return ImageFromBytes(data)
+}
+
+// content 返回图片内容，内存数据优先，否则读取 Path
+func (i ImgValue) content() ([]byte, error) {
+	if i.data != nil {
+		return i.data, nil
+	}
+	data, err := ioutil.ReadFile(i.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", i.Path, err)
+	}
+	return data, nil
+}
+
+// sameImage 判断两张图片是否为同一来源：内存图片比较数据，文件图片比较路径
+func sameImage(a, b ImgValue) bool {
+	if a.data != nil || b.data != nil {
+		return a.data != nil && b.data != nil && bytes.Equal(a.data, b.data)
+	}
+	return a.Path == b.Path
 }
 
 // SetImagesValues 设置图片
 /*
 	图片 header document foot 写的位置都是不一样的
 	所以只有在设置的时候能查到
+	SVG 图片没有可识别的 Fallback 时返回 ErrSVGFallbackRequired，不做替换
 */
-func (d *Docx) SetImagesValues(search string, img ImgValue) {
+func (d *Docx) SetImagesValues(search string, img ImgValue) error {
 
 	if img.Type == "" {
-		return
+		return nil
+	}
+	if img.Type == "svg" && !img.hasFallback() {
+		return fmt.Errorf("%w: %s", ErrSVGFallbackRequired, search)
 	}
 
+	return d.updateTrees(func(partName string, root *node) (bool, error) {
+		return d.addImageToDocx(search, img, partName, root), nil
+	})
+}
+
+// addImageToDocx 将部件文档树中 search 对应的图片标签替换为图片，返回是否有替换
+/*
+	标签所在的 w:t 拆分为 <w:t>前缀</w:t><w:drawing/><w:t>后缀</w:t>，
+	只有实际出现在 w:t 中的标签才会登记关系与图片
+*/
+func (d *Docx) addImageToDocx(search string, img ImgValue, fileName string, root *node) bool {
 	//找到所有标签并且去皮
-	contentTags := d.getVariablesForPart(d.MainPart)
-	d.MainPart = d.addImageToDocx(contentTags, search, img, d.MainPartName, d.MainPart)
-
-	for headerName, header := range d.Headers {
-		//找到所有标签并且去皮
-		contentTags1 := d.getVariablesForPart(header)
-		if len(contentTags1) > 0 {
-			hs := d.addImageToDocx(contentTags1, search, img, "word/header"+strconv.Itoa(headerName)+".xml", header)
-			if hs != "" {
-				d.Headers[headerName] = hs
-			}
+	var contentTags []string
+	for _, t := range root.findAll(func(c *node) bool { return c.typ == textNode }) {
+		contentTags = append(contentTags, d.getVariablesForPart(t.text)...)
+	}
 
+	changed := false
+	for _, mark := range imgVariablesFilter(contentTags, search) {
+		macro := ensureMacroCompleted(d, mark)
+		var texts []*node
+		for _, t := range root.texts(macro) {
+			if t.parent != nil && t.parent.name == "w:t" {
+				texts = append(texts, t)
+			}
+		}
+		if len(texts) == 0 {
+			continue
 		}
 
-	}
-
-	for footerName, footer := range d.Footers {
-		//找到所有标签并且去皮
-		contentTags2 := d.getVariablesForPart(footer)
-		if len(contentTags2) > 0 {
-			fs := d.addImageToDocx(contentTags2, search, img, "word/footer"+strconv.Itoa(footerName)+".xml", footer)
-			if fs != "" {
-				d.Headers[footerName] = fs
+		//整理每个 标签所用到的 height width
+		blipRid, svgRid := d.registerImage(fileName, mark, &img)
+		sized := img.withArgs(getImageArgs(strings.TrimPrefix(mark, search)))
+
+		for _, t := range texts {
+			for strings.Contains(t.text, macro) {
+				drawing, err := parseFragment(d.drawingXML(sized, blipRid, svgRid))
+				if err != nil {
+					break
+				}
+				wt := t.parent
+				pos := strings.Index(t.text, macro)
+				after := newTextElement(wt, t.text[pos+len(macro):])
+				t.text = t.text[:pos]
+				wt.insertAfter(append(drawing, after)...)
+				if p := wt.ancestor("w:p"); img.Caption != "" && p != nil {
+					styleID := d.styleID("caption")
+					if caption, err := parseFragment(captionXML(styleID, img.Caption, 0)); err == nil {
+						// 同一段落中已有图片的题注时插入到这些题注之后
+						lastCaption(p, styleID).insertAfter(caption...)
+					}
+				}
+				t = after.children[0]
+				changed = true
 			}
 		}
 	}
+	if changed && img.Caption != "" {
+		renumberFigures(root)
+	}
+	return changed
 }
 
-func (d *Docx) addImageToDocx(contentTags []string, search string, img ImgValue, fileName string, content string) string {
-	imgTpl := `<w:pict><v:shape type="#_x0000_t75" style="width:{WIDTH};height:{HEIGHT}"><v:imagedata r:id="{RID}" o:title=""/></v:shape></w:pict>`
-	for _, mark := range imgVariablesFilter(contentTags, search) {
-		//整理每个 标签所用到的 height width
-		img.Search = mark
-		rid := d.getRid(fileName, &img)
-		d.addImageToRelations(fileName, rid, &img)
+// registerImage 以 key 登记部件 fileName 中的图片关系，返回 a:blip 使用的关系 id 与 SVG 的关系 id
+// SVG 图片由替代图作为 a:blip 的主体，SVG 本身放在扩展元素中
+func (d *Docx) registerImage(fileName, key string, img *ImgValue) (blipRid, svgRid string) {
+	img.Search = key
+	rid := d.getRid(fileName, img)
+	d.addImageToRelations(fileName, rid, img)
+	if img.Type != "svg" {
+		return `rId` + rid, ""
+	}
+	fallback := img.fallbackImage()
+	fallback.Search = key + "#fallback"
+	fallbackRid := d.getRid(fileName, &fallback)
+	d.addImageToRelations(fileName, fallbackRid, &fallback)
+	return `rId` + fallbackRid, `rId` + rid
+}
 
-		xmlImage := strReplace([]string{`{RID}`, `{WIDTH}`, `{HEIGHT}`}, []string{`rId` + rid, strconv.Itoa(img.Width), strconv.Itoa(img.Height)}, imgTpl)
+// drawingXML 生成 DrawingML 图片 (w:drawing)，设置了 Anchor 时为浮动图片 wp:anchor，否则为内嵌图片 wp:inline
+// 尺寸由像素换算为 EMU，svgRid 不为空时在 a:blip 中加入 asvg:svgBlip 扩展
+func (d *Docx) drawingXML(img ImgValue, rid, svgRid string) string {
+	imgTpl := `<w:drawing>{OPEN}` +
+		`<wp:extent cx="{CX}" cy="{CY}"/><wp:effectExtent l="0" t="0" r="0" b="0"/>{WRAP}` +
+		`<wp:docPr id="{ID}" name="{NAME}"{ALT}/>` +
+		`<wp:cNvGraphicFramePr><a:graphicFrameLocks xmlns:a="` + nsDrawingML + `" noChangeAspect="1"/></wp:cNvGraphicFramePr>` +
+		`<a:graphic xmlns:a="` + nsDrawingML + `"><a:graphicData uri="` + nsPicture + `"><pic:pic xmlns:pic="` + nsPicture + `">` +
+		`<pic:nvPicPr><pic:cNvPr id="{ID}" name="{NAME}"/><pic:cNvPicPr/></pic:nvPicPr>` +
+		`<pic:blipFill><a:blip xmlns:r="` + nsRelationships + `" r:embed="{RID}"{SVG}<a:stretch><a:fillRect/></a:stretch></pic:blipFill>` +
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="{CX}" cy="{CY}"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>` +
+		`</pic:pic></a:graphicData></a:graphic>{CLOSE}</w:drawing>`
+
+	id := d.nextDocPrID()
+	open, wrap, end := `<wp:inline xmlns:wp="`+nsWordprocessingDrawing+`" distT="0" distB="0" distL="0" distR="0">`, "", `</wp:inline>`
+	if img.Anchor != nil {
+		open, wrap, end = img.Anchor.open(id), img.Anchor.wrapXML(), `</wp:anchor>`
+	}
+	svg := `/>`
+	if svgRid != "" {
+		svg = `><a:extLst><a:ext uri="` + svgBlipExtURI + `"><asvg:svgBlip xmlns:asvg="` + nsSVG + `" r:embed="` + svgRid + `"/></a:ext></a:extLst></a:blip>`
+	}
+	imgTpl = strReplace([]string{`{OPEN}`, `{WRAP}`, `{CLOSE}`, `{SVG}`}, []string{open, wrap, end, svg}, imgTpl)
 
-		re := regexp.MustCompile(`(<[^<]+>)([^<]*)(` + regexp.QuoteMeta(ensureMacroCompleted(d, mark)) + `)([^>]*)(<[^>]+>)`)
+	// 替代文本最后替换，避免其中的文字被当作模板变量
+	alt := ` descr="` + escapeText(imageName(img)) + `"`
+	if img.Title != "" {
+		alt += ` title="` + escapeText(img.Title) + `"`
+	}
+	return strReplace(
+		[]string{`{CX}`, `{CY}`, `{ID}`, `{NAME}`, `{RID}`, `{ALT}`},
+		[]string{
+			strconv.FormatInt(int64(img.Width)*emuPerPixel, 10),
+			strconv.FormatInt(int64(img.Height)*emuPerPixel, 10),
+			strconv.Itoa(id),
+			"Picture " + strconv.Itoa(id),
+			rid,
+			alt,
+		},
+		imgTpl,
+	)
+}
 
-		matches := re.FindStringSubmatch(content)
+// imageName 图片的替代文本，未设置 Description 时取文件名，内存图片为空
+func imageName(img ImgValue) string {
+	if img.Description != "" || img.Path == "" {
+		return img.Description
+	}
+	return path.Base(img.Path)
+}
 
-		if len(matches) > 0 {
-			wholeTag := matches[0]
+// captionXML 生成图片下方的题注段落，样式为 styleID，编号为 SEQ Figure 域，n 为域的缓存结果
+func captionXML(styleID, caption string, n int) string {
+	return `<w:p><w:pPr><w:pStyle w:val="` + escapeText(styleID) + `"/></w:pPr>` +
+		`<w:r><w:t xml:space="preserve">Figure </w:t></w:r>` +
+		`<w:fldSimple w:instr=" SEQ Figure \* ARABIC "><w:r><w:t>` + strconv.Itoa(n) + `</w:t></w:r></w:fldSimple>` +
+		textRun(": "+caption, "") + `</w:p>`
+}
 
-			matches = matches[1:]
-			openTag := matches[0]
-			prefix := matches[1]
-			postfix := matches[3]
-			closeTag := matches[4]
+// lastCaption 返回紧跟在段落 p 之后的题注段落中的最后一个，没有时返回 p
+func lastCaption(p *node, styleID string) *node {
+	last := p
+	for _, c := range p.parent.children[p.index()+1:] {
+		if c.typ == textNode && strings.TrimSpace(c.text) == "" {
+			continue
+		}
+		if !isCaption(c, styleID) {
+			break
+		}
+		last = c
+	}
+	return last
+}
 
-			replacexml := StringBuilder(openTag, prefix, closeTag, xmlImage, openTag, postfix, closeTag)
+// isCaption 判断节点是否为样式为 styleID 且包含 SEQ Figure 域的题注段落
+func isCaption(n *node, styleID string) bool {
+	if n.typ != elementNode || n.name != "w:p" {
+		return false
+	}
+	styled := false
+	for _, s := range n.elements("w:pStyle") {
+		styled = styled || s.attr("w:val") == styleID
+	}
+	if !styled {
+		return false
+	}
+	for _, fld := range n.elements("w:fldSimple") {
+		if isFigureField(fld) {
+			return true
+		}
+	}
+	return false
+}
 
-			return strings.Replace(content, wholeTag, replacexml, -1)
+// isFigureField 判断简单域是否为 SEQ Figure
+func isFigureField(fld *node) bool {
+	f := strings.Fields(fld.attr("w:instr"))
+	return len(f) >= 2 && f[0] == "SEQ" && f[1] == "Figure"
+}
 
+// renumberFigures 按出现顺序重新编号部件中 SEQ Figure 简单域的缓存结果
+func renumberFigures(root *node) {
+	n := 0
+	for _, fld := range root.elements("w:fldSimple") {
+		if !isFigureField(fld) {
+			continue
+		}
+		n++
+		if ts := fld.elements("w:t"); len(ts) > 0 {
+			ts[0].children = nil
+			ts[0].append(&node{typ: textNode, text: strconv.Itoa(n)})
 		}
+	}
+}
 
+// nextDocPrID 返回文档中未被使用的 wp:docPr id，首次调用时扫描主体、页眉和页脚中已有的最大值
+func (d *Docx) nextDocPrID() int {
+	if d.docPrID == 0 {
+		reg := regexp.MustCompile(`<wp:docPr[^>]*?\sid="(\d+)"`)
+		d.eachPart(func(_, content string) error {
+			for _, m := range reg.FindAllStringSubmatch(content, -1) {
+				if id, err := strconv.Atoi(m[1]); err == nil && id > d.docPrID {
+					d.docPrID = id
+				}
+			}
+			return nil
+		})
 	}
-	return ""
+	d.docPrID++
+	return d.docPrID
 }
 
+// getRid 返回部件中未被使用的关系 id 序号 (已有 rIdN 的最大值加一)
 func (d *Docx) getRid(partFileName string, img *ImgValue) string {
-
-	rid := strconv.Itoa(strings.Count(d.Relations[partFileName], "<Relationship"))
-
-	return rid
+	last := 0
+	for _, m := range ridReg.FindAllStringSubmatch(d.Relations[partFileName], -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > last {
+			last = n
+		}
+	}
+	return strconv.Itoa(last + 1)
 }
 
 /*
@@ -162,39 +454,56 @@ func (d *Docx) getRid(partFileName string, img *ImgValue) string {
 	}
 */
 func (d *Docx) addImageToRelations(partFileName string, rid string, img *ImgValue) {
-	typeTpl := "<Override PartName=\"/word/media/{IMG}\" ContentType=\"image/{EXT}\"/>"
+	typeTpl := "<Override PartName=\"/word/media/{IMG}\" ContentType=\"{TYPE}\"/>"
 	relationTpl := "<Relationship Id=\"{RID}\" Type=\"http://schemas.openxmlformats.org/officeDocument/2006/relationships/image\" Target=\"media/{IMG}\"/>"
-	newRelationsTpl := "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n<Relationships xmlns=\"http://schemas.openxmlformats.org/package/2006/relationships\"></Relationships>"
-	newRelationsTypeTpl := "<Override PartName=\"/{RELS}\" ContentType=\"application/vnd.openxmlformats-package.relationships+xml\"/>"
 
 	if _, ok := d.NewImages[img.Search]; !ok && !d.findDuplicateTags(*img) {
 		partName := pathInfo(partFileName)
 		img.Rid = rid
-		img.Replace = `image_` + rid + `_` + partName + `.` + img.Type
+		img.Replace = path.Base(d.uniqueMediaName(`word/media/image_` + rid + `_` + partName + `.` + img.Type))
 		d.NewImages[img.Search] = *img
 
-		typeTpl = strReplace([]string{`{IMG}`, `{EXT}`}, []string{img.Replace, img.Type}, typeTpl)
+		typeTpl = strReplace([]string{`{IMG}`, `{TYPE}`}, []string{img.Replace, imageContentType(img.Type)}, typeTpl)
 		d.ContentTypes = strings.Replace(d.ContentTypes, `</Types>`, typeTpl, -1) + `</Types>`
 	} else {
 		d.NewImages[img.Search] = d.getDuplicateTags(*img)
 	}
 	xmlImageRelation := strReplace([]string{`{RID}`, `{IMG}`}, []string{"rId" + rid, d.NewImages[img.Search].Replace}, relationTpl)
 
+	d.addRelationXML(partFileName, xmlImageRelation)
+}
+
+// addRelationXML 向部件的关系文件添加 Relationship 元素，部件没有关系文件时新建
+func (d *Docx) addRelationXML(partFileName, rel string) {
+	newRelationsTpl := "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n<Relationships xmlns=\"http://schemas.openxmlformats.org/package/2006/relationships\"></Relationships>"
+	newRelationsTypeTpl := "<Override PartName=\"/{RELS}\" ContentType=\"application/vnd.openxmlformats-package.relationships+xml\"/>"
+
 	//如果没有 则添加
-	if _, ok := d.Relations[partFileName]; !ok {
+	if d.Relations[partFileName] == "" {
 		d.Relations[partFileName] = newRelationsTpl
-		xmlRelationsType := strings.Replace(newRelationsTypeTpl, `{RELS}`, getRelationsName(partFileName), -1) + `</Types>`
+		xmlRelationsType := strings.Replace(newRelationsTypeTpl, `{RELS}`, getRelationsName(partFileName), -1)
 
-		d.ContentTypes = strings.Replace(d.ContentTypes, `</Types>`, xmlRelationsType, -1) + `</Types>`
+		d.ContentTypes = strings.Replace(d.ContentTypes, `</Types>`, xmlRelationsType+`</Types>`, 1)
 	}
 
-	d.Relations[partFileName] = strings.Replace(d.Relations[partFileName], `</Relationships>`, xmlImageRelation, -1) + `</Relationships>`
+	d.Relations[partFileName] = strings.Replace(d.Relations[partFileName], `</Relationships>`, rel, -1) + `</Relationships>`
+}
+
+// addRelationship 向部件添加关系并返回其 id，external 为 true 时目标为外部地址 (如超链接)
+func (d *Docx) addRelationship(partFileName, relType, target string, external bool) string {
+	rid := `rId` + d.getRid(partFileName, nil)
+	mode := ""
+	if external {
+		mode = ` TargetMode="External"`
+	}
+	d.addRelationXML(partFileName, `<Relationship Id="`+rid+`" Type="`+relType+`" Target="`+escapeText(target)+`"`+mode+`/>`)
+	return rid
 }
 
 // 获取一样的
 func (d *Docx) getDuplicateTags(img ImgValue) ImgValue {
 	for _, v := range d.NewImages {
-		if v.Path == img.Path {
+		if sameImage(v, img) {
 			return v
 		}
 	}
@@ -204,7 +513,7 @@ func (d *Docx) getDuplicateTags(img ImgValue) ImgValue {
 func (d *Docx) findDuplicateTags(img ImgValue) (r bool) {
 	r = false
 	for _, v := range d.NewImages {
-		if v.Path == img.Path {
+		if sameImage(v, img) {
 			r = true
 			break
 		}
@@ -219,21 +528,33 @@ func pathInfo(fileFullName string) string {
 	return filenameall[0 : len(filenameall)-len(filesuffix)]
 }
 
-// 获取 标签上设置的图片参数
-func getImageArgs(varNameWithArgs string) (varInlineArgs map[string]string) {
+// imageSizeReg 匹配 WxH 形式的尺寸参数，如 100x50、2cmxauto、50%x50%
+var imageSizeReg = regexp.MustCompile(`^(\d*\.?\d+(?:px|cm|mm|in|%)?|auto)x(\d*\.?\d+(?:px|cm|mm|in|%)?|auto)$`)
+
+// pixelsPerUnit 各长度单位对应的像素数 (96 DPI)
+var pixelsPerUnit = map[string]float64{
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+}
+
+// 获取 标签上设置的图片参数，args 为去掉图片名后的部分，如 :100x50、:width=2cm:ratio=false
+func getImageArgs(args string) (varInlineArgs map[string]string) {
 	varInlineArgs = make(map[string]string)
-	vn := strings.Split(varNameWithArgs, ":")[1:]
-	reg := regexp.MustCompile(`([0-9]*[a-z%]{0,2}|auto)x([0-9]*[a-z%]{0,2}|auto)`)
+	vn := strings.Split(strings.ToLower(args), ":")[1:]
 	for k, v := range vn {
 		if strings.Contains(v, "=") { // arg=value
 			argName, argValue := listString(v, "=")
 			if argName == "size" {
-				varInlineArgs["width"], varInlineArgs["height"] = listString(argValue, "x")
+				if m := imageSizeReg.FindStringSubmatch(argValue); m != nil {
+					varInlineArgs["width"], varInlineArgs["height"] = m[1], m[2]
+				}
 			} else {
-				varInlineArgs[strings.ToLower(argName)] = argValue
+				varInlineArgs[argName] = argValue
 			}
-		} else if reg.MatchString(v) { // 60x40
-			varInlineArgs["width"], varInlineArgs["height"] = listString(v, "x")
+		} else if m := imageSizeReg.FindStringSubmatch(v); m != nil { // 60x40
+			varInlineArgs["width"], varInlineArgs["height"] = m[1], m[2]
 		} else {
 			switch k {
 			case 0:
@@ -249,6 +570,74 @@ func getImageArgs(varNameWithArgs string) (varInlineArgs map[string]string) {
 	return
 }
 
+// withArgs 按标签参数调整图片尺寸
+/*
+	宽高都指定且 ratio 不为 false 时，在宽高范围内按原始比例缩放
+	只指定一边 (另一边为 auto 或未指定) 时，另一边按原始比例计算
+	百分比相对于图片的实际尺寸
+*/
+func (i ImgValue) withArgs(args map[string]string) ImgValue {
+	if args["width"] == "" && args["height"] == "" {
+		return i
+	}
+	nw, nh := i.naturalSize()
+	if nw <= 0 || nh <= 0 {
+		return i
+	}
+	w, wok := imageDimension(args["width"], nw)
+	h, hok := imageDimension(args["height"], nh)
+
+	switch {
+	case wok && hok:
+		if ratio := args["ratio"]; ratio != "false" && ratio != "f" && ratio != "0" && ratio != "no" {
+			scale := math.Min(w/nw, h/nh)
+			w, h = nw*scale, nh*scale
+		}
+	case wok:
+		h = w * nh / nw
+	case hok:
+		w = h * nw / nh
+	default:
+		w, h = nw, nh
+	}
+	i.Width = int(math.Round(w))
+	i.Height = int(math.Round(h))
+	return i
+}
+
+// naturalSize 图片的实际像素尺寸，无法读取时使用 ImgValue 中的尺寸
+func (i ImgValue) naturalSize() (float64, float64) {
+	if data, err := i.content(); err == nil {
+		if w, h, err := imageSize(data, sniffImageType(data)); err == nil {
+			return float64(w), float64(h)
+		}
+	}
+	return float64(i.Width), float64(i.Height)
+}
+
+// imageDimension 将带单位的尺寸换算为像素，无单位时为像素，% 相对于 natural
+// auto、空值或无法解析时 ok 为 false
+func imageDimension(v string, natural float64) (px float64, ok bool) {
+	unit := ""
+	switch {
+	case strings.HasSuffix(v, "%"):
+		unit = "%"
+	case len(v) > 2 && pixelsPerUnit[v[len(v)-2:]] > 0:
+		unit = v[len(v)-2:]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(v, unit), 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	switch unit {
+	case "%":
+		return natural * n / 100, true
+	case "":
+		return n, true
+	}
+	return n * pixelsPerUnit[unit], true
+}
+
 func listString(s, spe string) (argKey, argValue string) {
 	arg := strings.SplitN(s, spe, 2)
 	return arg[0], arg[1]
@@ -290,24 +679,108 @@ func getImagesType(imgName string) (string, error) {
 
 		return "", errors.New(errMes)
 	}
-	var itype string
-	if bytes.Equal(pngByte, fi[0:8]) {
-		itype = PNGTYPE
+	itype := map[string]string{
+		"png":  PNGTYPE,
+		"gif":  GIFTYPE,
+		"bmp":  BMPTYPE,
+		"jpeg": JPGTYPE,
+	}[sniffImageType(fi)]
+
+	if itype == "" {
+		return itype, errors.New("undefined type")
 	}
-	if bytes.Equal(gifByte, fi[0:3]) {
-		itype = GIFTYPE
+	return itype, nil
+}
+
+// sniffImageType 根据文件头识别图片格式，返回与 image.DecodeConfig 一致的简称，无法识别时为空
+func sniffImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, pngByte):
+		return "png"
+	case bytes.HasPrefix(data, gifByte):
+		return "gif"
+	case bytes.HasPrefix(data, bmpByte):
+		return "bmp"
+	case bytes.HasPrefix(data, jpgByte):
+		return "jpeg"
+	case isSVG(data):
+		return "svg"
 	}
-	if bytes.Equal(bmpByte, fi[0:2]) {
-		itype = BMPTYPE
+	return ""
+}
+
+// isSVG 判断数据是否为 SVG 文本：以 < 开头且前 4KB 中包含 <svg 标签
+func isSVG(data []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
 	}
-	if bytes.Equal(jpgByte, fi[0:3]) {
-		itype = JPGTYPE
+	if len(head) > 4096 {
+		head = head[:4096]
 	}
+	return svgTagReg.Match(head)
+}
 
-	if itype == "" {
-		return itype, errors.New("undefined type")
+// svgSize 读取 SVG 根元素的 width、height，缺少时使用 viewBox 的宽高
+func svgSize(data []byte) (width, height int, err error) {
+	tag := string(svgTagReg.Find(data))
+	w, wok := imageDimension(strings.ToLower(attrValue(tag, "width")), 0)
+	h, hok := imageDimension(strings.ToLower(attrValue(tag, "height")), 0)
+	if !wok || !hok || w == 0 || h == 0 {
+		box := strings.Fields(strings.Replace(attrValue(tag, "viewBox"), ",", " ", -1))
+		if len(box) != 4 {
+			return 0, 0, fmt.Errorf("%w: svg without size", ErrUnsupportedImage)
+		}
+		w, wok = imageDimension(box[2], 0)
+		h, hok = imageDimension(box[3], 0)
+		if !wok || !hok {
+			return 0, 0, fmt.Errorf("%w: invalid svg viewBox", ErrUnsupportedImage)
+		}
 	}
-	return itype, nil
+	return int(math.Round(w)), int(math.Round(h)), nil
+}
+
+// hasFallback 判断是否提供了可识别的栅格替代图
+func (i ImgValue) hasFallback() bool {
+	t := sniffImageType(i.Fallback)
+	return t != "" && t != "svg"
+}
+
+// fallbackImage SVG 图片的栅格替代图，调用前需由 hasFallback 确认已提供
+func (i ImgValue) fallbackImage() ImgValue {
+	return ImgValue{Type: sniffImageType(i.Fallback), Width: i.Width, Height: i.Height, data: i.Fallback}
+}
+
+// imageContentType 图片扩展名对应的内容类型
+func imageContentType(ext string) string {
+	ext = normalizeImageExt(ext)
+	if ext == "svg" {
+		return "image/svg+xml"
+	}
+	return "image/" + ext
+}
+
+// imageSize 读取图片的像素尺寸，标准库不支持的 BMP 直接解析文件头，SVG 读取根元素的属性
+func imageSize(data []byte, t string) (width, height int, err error) {
+	if t == "svg" {
+		return svgSize(data)
+	}
+	if t == "bmp" {
+		if len(data) < 26 {
+			return 0, 0, ErrUnsupportedImage
+		}
+		width = int(int32(binary.LittleEndian.Uint32(data[18:22])))
+		height = int(int32(binary.LittleEndian.Uint32(data[22:26])))
+		if height < 0 { // 自上而下存储的位图高度为负
+			height = -height
+		}
+		return width, height, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return cfg.Width, cfg.Height, nil
 }
 
 // 找到所有标签 并且去皮
@@ -323,28 +796,3 @@ func (d *Docx) getVariablesForPart(search string) []string {
 	}
 	return total
 }
-
-// 修复错误标签 (防止标签被 Word 内部 XML 标签切断)
-func (d *Docx) fixBrokenMacros() {
-	if len(d.Config.PlaceholderPrefix) < 2 {
-		return
-	}
-	p1 := regexp.QuoteMeta(d.Config.PlaceholderPrefix[:1])
-	pRest := regexp.QuoteMeta(d.Config.PlaceholderPrefix[1:])
-	s := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
-
-	// 匹配前缀第一位 + (前缀剩余位 或 标签+前缀剩余位) + 内容 + 后缀
-	regStr := p1 + `(?:` + pRest + `|[\s\S]*?\>` + pRest + `)[\s\S]*?` + s
-	re, err := regexp.Compile(regStr)
-	if err != nil {
-		return
-	}
-
-	f := func(s string) (src string) {
-		cleanReg, _ := regexp.Compile(`<[\S\s]+?>`)
-		src = cleanReg.ReplaceAllString(s, "")
-		return
-	}
-	// 修复 content
-	d.MainPart = re.ReplaceAllStringFunc(d.MainPart, f)
-}
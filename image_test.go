@@ -0,0 +1,525 @@
+package docx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testImage 在临时目录中生成一张指定尺寸的 PNG 图片并返回路径
+func testImage(t *testing.T, name string, width, height int) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSetImagesValuesDrawing(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{img:logo}}`)+testParagraph(`<w:drawing><wp:inline><wp:docPr id="7" name="Old"/></wp:inline></w:drawing>`)+testParagraph(`{{img:logo2}}`))
+	defer doc.Close()
+
+	img := doc.GetArrangeImage(testImage(t, "logo.png", 20, 10))
+	doc.SetImagesValues("img:logo", img)
+	doc.SetImagesValues("img:logo2", img.SetWidth(40))
+
+	for _, want := range []string{
+		`<wp:extent cx="190500" cy="95250"/>`,
+		`<wp:docPr id="8" name="Picture 8" descr="logo.png"/>`,
+		`<wp:extent cx="381000" cy="95250"/>`,
+		`<wp:docPr id="9" name="Picture 9" descr="logo.png"/>`,
+		`<pic:cNvPr id="9" name="Picture 9"/>`,
+		`<a:blip xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:embed="rId`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("图片 XML 中缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `<w:pict>`) || strings.Contains(doc.MainPart, `{{img:`) {
+		t.Errorf("应使用 DrawingML 替换占位符: %s", doc.MainPart)
+	}
+	if _, err := doc.SaveToBuffer(); err != nil {
+		t.Errorf("保存失败: %v", err)
+	}
+}
+
+func TestImageFromBytes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	pngData := buf.Bytes()
+	// 2x3 自上而下存储的 BMP 文件头
+	bmpData := make([]byte, 54)
+	copy(bmpData, "BM")
+	bmpData[18], bmpData[22], bmpData[23], bmpData[24], bmpData[25] = 2, 0xfd, 0xff, 0xff, 0xff
+
+	if _, err := ImageFromBytes([]byte("not an image")); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("未知格式应返回 ErrUnsupportedImage: %v", err)
+	}
+	bmp, err := ImageFromBytes(bmpData)
+	if err != nil || bmp.Type != "bmp" || bmp.Width != 2 || bmp.Height != 3 {
+		t.Errorf("BMP 识别错误: %+v %v", bmp, err)
+	}
+	img, err := ImageFromReader(bytes.NewReader(pngData))
+	if err != nil || img.Type != "png" || img.Width != 3 || img.Height != 2 {
+		t.Fatalf("PNG 识别错误: %+v %v", img, err)
+	}
+
+	doc := newTestDocx(t, testParagraph(`{{img:a}}`)+testParagraph(`{{img:b}}`))
+	defer doc.Close()
+	doc.SetImagesValues("img:a", img)
+	doc.SetImagesValues("img:b", bmp)
+	buf2, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf2.Bytes()), int64(buf2.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	media := make(map[string][]byte)
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "word/media/") {
+			rc, _ := f.Open()
+			media[path.Ext(f.Name)], _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	if len(media) != 2 || !bytes.Equal(media[".png"], pngData) || !bytes.Equal(media[".bmp"], bmpData) {
+		t.Errorf("内存图片应直接写入 media: %v", len(media))
+	}
+}
+
+func TestImageArgs(t *testing.T) {
+	p := testImage(t, "photo.png", 200, 100)
+	doc := newTestDocx(t, testParagraph(`{{photo:100x100}}`)+testParagraph(`{{photo:width=1in:height=auto}}`)+
+		testParagraph(`{{photo:size=50%x10px:ratio=false}}`)+testParagraph(`{{photo:2.54cm}}`))
+	defer doc.Close()
+	img := doc.GetArrangeImage(p)
+	doc.SetImagesValues("photo", img.SetWidth(1))
+
+	for _, size := range [][2]int{{100, 50}, {96, 48}, {100, 10}, {96, 48}} {
+		want := fmt.Sprintf(`<wp:extent cx="%d" cy="%d"/>`, size[0]*emuPerPixel, size[1]*emuPerPixel)
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("缺少尺寸 %v: %s", size, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `{{photo`) {
+		t.Errorf("所有带参数的标签都应被替换: %s", doc.MainPart)
+	}
+
+	if args := getImageArgs(":100pxx5mm"); args["width"] != "100px" || args["height"] != "5mm" {
+		t.Errorf("尺寸参数解析错误: %v", args)
+	}
+}
+
+func TestReplaceImage(t *testing.T) {
+	drawing := `<w:r><w:drawing><wp:inline><wp:extent cx="100" cy="100"/><wp:docPr id="1" name="Picture 1" descr="Company &amp; Logo"/>` +
+		`<a:graphic><a:graphicData><pic:pic><pic:blipFill><a:blip r:embed="rId5"/></pic:blipFill>` +
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="100" cy="100"/></a:xfrm></pic:spPr></pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`
+	vml := `<w:r><w:pict><v:shape style="width:10pt;height:10pt"><v:imagedata r:id="rId6" o:title="stamp"/></v:shape></w:pict></w:r>`
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, `<w:p>`+drawing+`</w:p><w:p>`+vml+`</w:p>`),
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>` +
+			`<Relationship Id="rId6" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image2.png"/></Relationships>`,
+		"word/media/image1.png": "old",
+		"word/media/image2.png": "old",
+	})
+	defer doc.Close()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	img, _ := ImageFromBytes(buf.Bytes())
+	bmp, _ := ImageFromBytes(append([]byte("BM"), make([]byte, 60)...))
+
+	if err := doc.ReplaceImage("missing", img); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("图片不存在时应返回 ErrImageNotFound: %v", err)
+	}
+	if err := doc.ReplaceImage("Company & Logo", img); err != nil {
+		t.Fatalf("替换图片失败: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, `<wp:extent cx="38100" cy="19050"/>`) || !strings.Contains(doc.MainPart, `<a:ext cx="38100" cy="19050"/>`) {
+		t.Errorf("应使用新图片的尺寸: %s", doc.MainPart)
+	}
+	bmp.KeepSize = true
+	if err := doc.ReplaceImage("stamp", bmp); err != nil {
+		t.Fatalf("替换 VML 图片失败: %v", err)
+	}
+	if !strings.Contains(doc.MainPart, `width:10pt;height:10pt`) {
+		t.Errorf("KeepSize 时应保留原尺寸: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.Relations["word/document.xml"], `Target="media/image2.bmp"`) || !strings.Contains(doc.ContentTypes, `<Default Extension="bmp" ContentType="image/bmp"/>`) {
+		t.Errorf("扩展名改变时应更新关系与内容类型: %s %s", doc.Relations["word/document.xml"], doc.ContentTypes)
+	}
+
+	out, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	if !bytes.Equal(files["word/media/image1.png"], buf.Bytes()) || len(files["word/media/image2.bmp"]) != 62 {
+		t.Error("media 文件内容未被替换")
+	}
+}
+
+func TestReplaceSharedImage(t *testing.T) {
+	drawing := func(name, rid string) string {
+		return `<w:p><w:r><w:drawing><wp:inline><wp:docPr id="1" name="` + name + `"/><a:blip r:embed="` + rid + `"/></wp:inline></w:drawing></w:r></w:p>`
+	}
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, drawing("a", "rId5")+drawing("b", "rId6")),
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId5" Type="` + imageRelType + `" Target="/word/media/image1.png"/>` +
+			`<Relationship Id="rId6" Type="` + imageRelType + `" Target="media/image1.png"/></Relationships>`,
+		"word/media/image1.png":   "old",
+		"word/media/image1_1.png": "other",
+	})
+	defer doc.Close()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	img, _ := ImageFromBytes(buf.Bytes())
+	img.KeepSize = true
+	if err := doc.ReplaceImage("a", img); err != nil {
+		t.Fatalf("替换图片失败: %v", err)
+	}
+	rels := doc.Relations["word/document.xml"]
+	if !strings.Contains(rels, `Id="rId5" Type="`+imageRelType+`" Target="media/image1_2.png"`) || !strings.Contains(rels, `Target="media/image1.png"`) {
+		t.Errorf("共享的图片应写入新文件并只修改当前关系: %s", rels)
+	}
+	if string(doc.media["word/media/image1_2.png"]) != buf.String() || doc.media["word/media/image1.png"] != nil {
+		t.Errorf("不应覆盖其他关系引用的图片: %v", doc.media)
+	}
+}
+
+func TestAnchoredImage(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{img:stamp}}`)+testParagraph(`{{img:sign}}`))
+	defer doc.Close()
+
+	img := doc.GetArrangeImage(testImage(t, "stamp.png", 10, 10))
+	img.Anchor = &ImageAnchor{Wrap: "behind", HorizontalFrom: "page", OffsetX: 2, OffsetY: -1, ZOrder: 5}
+	doc.SetImagesValues("img:stamp", img)
+	img.Anchor = &ImageAnchor{Wrap: "tight"}
+	doc.SetImagesValues("img:sign", img)
+
+	for _, want := range []string{
+		`relativeHeight="5" behindDoc="1"`,
+		`<wp:positionH relativeFrom="page"><wp:posOffset>19050</wp:posOffset></wp:positionH><wp:positionV relativeFrom="paragraph"><wp:posOffset>-9525</wp:posOffset></wp:positionV><wp:extent`,
+		`<wp:effectExtent l="0" t="0" r="0" b="0"/><wp:wrapNone/><wp:docPr`,
+		`behindDoc="0"`,
+		`<wp:wrapTight wrapText="bothSides">`,
+		`</a:graphic></wp:anchor></w:drawing>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("浮动图片中缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `<wp:inline`) {
+		t.Errorf("设置 Anchor 时不应生成内嵌图片: %s", doc.MainPart)
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	svg := []byte(`<?xml version="1.0"?>` + "\n" + `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 40 20"><rect width="40" height="20"/></svg>`)
+	img, err := ImageFromBytes(svg)
+	if err != nil || img.Type != "svg" || img.Width != 40 || img.Height != 20 {
+		t.Fatalf("SVG 识别错误: %+v %v", img, err)
+	}
+	if w, h, _ := svgSize([]byte(`<svg width="1in" height="48px">`)); w != 96 || h != 48 {
+		t.Errorf("SVG 尺寸错误: %d %d", w, h)
+	}
+
+	doc := newTestDocx(t, testParagraph(`{{chart}}`))
+	defer doc.Close()
+	if err := doc.SetImagesValues("chart", img); !errors.Is(err, ErrSVGFallbackRequired) || !strings.Contains(doc.MainPart, `{{chart}}`) {
+		t.Fatalf("未提供替代图时应返回 ErrSVGFallbackRequired: %v", err)
+	}
+	var fallback bytes.Buffer
+	if err := png.Encode(&fallback, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	img.Fallback = fallback.Bytes()
+	if err := doc.SetImagesValues("chart", img); err != nil {
+		t.Fatalf("插入 SVG 图片失败: %v", err)
+	}
+
+	if !strings.Contains(doc.MainPart, `<a:extLst><a:ext uri="`+svgBlipExtURI+`"><asvg:svgBlip xmlns:asvg="`+nsSVG+`" r:embed="rId1"/></a:ext></a:extLst></a:blip>`) ||
+		!strings.Contains(doc.MainPart, `r:embed="rId2"><a:extLst>`) {
+		t.Errorf("应生成 svgBlip 扩展并以替代图作为主体: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.ContentTypes, `ContentType="image/svg+xml"`) || !strings.Contains(doc.ContentTypes, `ContentType="image/png"`) {
+		t.Errorf("应注册 SVG 与 PNG 的内容类型: %s", doc.ContentTypes)
+	}
+
+	out, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	exts := make(map[string]bool)
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "word/media/") {
+			exts[path.Ext(f.Name)] = true
+		}
+	}
+	if !exts[".svg"] || !exts[".png"] {
+		t.Errorf("media 中应同时包含 SVG 与替代 PNG: %v", exts)
+	}
+}
+
+func TestImagesInHeadersAndFooters(t *testing.T) {
+	hdr := `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">%s</w:hdr>`
+	ftr := `<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">%s</w:ftr>`
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{logo}}`)),
+		"word/header1.xml":  fmt.Sprintf(hdr, testParagraph(`{{logo}}`)),
+		"word/footer1.xml":  fmt.Sprintf(ftr, testParagraph(`{{logo}}`)),
+		"word/_rels/header1.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="t" Target="a.xml"/><Relationship Id="rId7" Type="t" Target="b.xml"/></Relationships>`,
+		"word/header2.xml": fmt.Sprintf(hdr, testParagraph(`text`)),
+	})
+	defer doc.Close()
+
+	doc.SetImagesValues("logo", doc.GetArrangeImage(testImage(t, "logo.png", 4, 4)))
+
+	if !strings.Contains(doc.Headers[1], `r:embed="rId8"`) || !strings.Contains(doc.Relations["word/header1.xml"], `<Relationship Id="rId8"`) {
+		t.Errorf("页眉中应使用未被占用的关系 id: %s", doc.Relations["word/header1.xml"])
+	}
+	if !strings.Contains(doc.Footers[1], `<w:drawing>`) || strings.Contains(doc.Headers[1], `<w:ftr`) {
+		t.Errorf("页脚图片应写入 Footers: %s", doc.Footers[1])
+	}
+	if !strings.Contains(doc.Footers[1], `r:embed="rId1"`) || !strings.Contains(doc.Relations["word/footer1.xml"], `<Relationship Id="rId1"`) {
+		t.Errorf("没有关系文件的页脚应新建关系: %s", doc.Relations["word/footer1.xml"])
+	}
+
+	out, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	rels := make(map[string]string)
+	for _, f := range zr.File {
+		if f.Name == "[Content_Types].xml" {
+			rc, _ := f.Open()
+			b, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			if _, err := parseXML(string(b)); err != nil || strings.Count(string(b), `</Types>`) != 1 {
+				t.Errorf("[Content_Types].xml 格式错误: %v %s", err, b)
+			}
+		}
+		if strings.HasSuffix(f.Name, ".rels") {
+			if _, ok := rels[f.Name]; ok {
+				t.Errorf("关系文件重复写入: %s", f.Name)
+			}
+			rc, _ := f.Open()
+			b, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			rels[f.Name] = string(b)
+		}
+	}
+	if !strings.Contains(rels["word/_rels/footer1.xml.rels"], `Target="media/`) || !strings.Contains(rels["word/_rels/header1.xml.rels"], `Target="b.xml"`) {
+		t.Errorf("页眉页脚的关系文件错误: %v", rels)
+	}
+	if _, ok := rels["word/_rels/header2.xml.rels"]; ok {
+		t.Error("不应为没有关系的部件写入空的关系文件")
+	}
+}
+
+func TestRelationsName(t *testing.T) {
+	for part, rels := range map[string]string{
+		"word/document.xml":     "word/_rels/document.xml.rels",
+		"customXml/item1.xml":   "customXml/_rels/item1.xml.rels",
+		"word/glossary/doc.xml": "word/glossary/_rels/doc.xml.rels",
+	} {
+		if got := getRelationsName(part); got != rels {
+			t.Errorf("%s 的关系文件名错误: %s", part, got)
+		}
+		if got := getRemoveRelationsName(rels); got != part {
+			t.Errorf("%s 所属部件错误: %s", rels, got)
+		}
+	}
+	if got := getRemoveRelationsName("_rels/.rels"); got != "_rels/.rels" {
+		t.Errorf("包关系文件不属于任何部件: %s", got)
+	}
+}
+
+func TestMediaCleanup(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	logo := buf.String()
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{a}}`)+testParagraph(`{{b}}`)+
+			`<w:p><w:r><w:drawing><a:blip r:embed="rId5"/></w:drawing></w:r></w:p>`),
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId5" Type="` + imageRelType + `" Target="media/image1.png"/>` +
+			`<Relationship Id="rId6" Type="` + imageRelType + `" Target="media/image2.png"/></Relationships>`,
+		"word/media/image1.png": logo,
+		"word/media/image2.png": "unused",
+		"word/media/orphan.png": "orphan",
+	})
+	defer doc.Close()
+
+	p := testImage(t, "a.png", 2, 2)
+	doc.SetImagesValues("a", doc.GetArrangeImage(p))
+	fromBytes, _ := ImageFromBytes([]byte(logo))
+	doc.SetImagesValues("b", fromBytes)
+
+	out, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	var media []string
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		if isMediaName(f.Name) {
+			media = append(media, f.Name)
+		}
+		rc, _ := f.Open()
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if len(media) != 1 || media[0] != "word/media/image1.png" {
+		t.Errorf("相同内容的图片只应保留一份: %v", media)
+	}
+	rels := files["word/_rels/document.xml.rels"]
+	if strings.Contains(rels, `rId6`) || strings.Count(rels, `Target="media/image1.png"`) != 3 {
+		t.Errorf("关系应指向保留的图片并删除未引用的关系: %s", rels)
+	}
+	if strings.Contains(files["[Content_Types].xml"], `image_`) {
+		t.Errorf("应删除被合并图片的内容类型: %s", files["[Content_Types].xml"])
+	}
+	if !strings.Contains(doc.Relations["word/document.xml"], `rId6`) || !strings.Contains(doc.ContentTypes, `image_`) {
+		t.Error("保存时不应修改文档的关系与内容类型")
+	}
+
+	report := doc.MediaReport()
+	if len(report.Duplicates) != 2 || len(report.Unused) != 2 || report.RemovedRelations != 1 ||
+		report.BytesSaved != int64(2*len(logo)+len("unused")+len("orphan")) {
+		t.Errorf("整理结果错误: %+v", report)
+	}
+}
+
+func TestNewImageNameCollision(t *testing.T) {
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{a}}`)+`<w:p><w:r><w:drawing><a:blip r:embed="rId1"/></w:drawing></w:r></w:p>`),
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + imageRelType + `" Target="media/image_2_document.png"/></Relationships>`,
+		"word/media/image_2_document.png": "old",
+	})
+	defer doc.Close()
+
+	doc.SetImagesValues("a", doc.GetArrangeImage(testImage(t, "a.png", 2, 2)))
+	out, err := doc.SaveToBuffer()
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if files["word/media/image_2_document.png"] != "old" || !strings.HasPrefix(files["word/media/image_2_document_1.png"], "\x89PNG") {
+		t.Errorf("新图片不应与已有 media 重名: %v", files)
+	}
+}
+
+func TestRelationRefs(t *testing.T) {
+	content := `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:rel="` + relationshipsNS + `" xmlns:ofc="` + officeNS + `" xmlns:r="urn:other">` +
+		`<a:blip rel:embed="rId1"/><v:imagedata ofc:relid="rId2"/><x:y r:id="rId3"/></w:document>`
+	refs, ok := relationRefs(content)
+	if !ok || !refs["rId1"] || !refs["rId2"] || refs["rId3"] {
+		t.Errorf("应按命名空间识别关系引用: %v", refs)
+	}
+	if _, ok := relationRefs(`<w:document><a:blip r:embed="rId1"/></w:document>`); ok {
+		t.Error("没有声明关系命名空间时不应判断引用")
+	}
+}
+
+func TestImageAltTextAndCaption(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{img:b}}`)+testParagraph(`{{img:a}}`))
+	defer doc.Close()
+
+	img := doc.GetArrangeImage(testImage(t, "chart.png", 2, 2))
+	img.Description = `Sales by "region" & {RID}`
+	img.Title = "Sales"
+	img.Caption = "Quarterly <sales>"
+	doc.SetImagesValues("img:a", img)
+	img.Description, img.Title, img.Caption = "", "", "First"
+	doc.SetImagesValues("img:b", img)
+
+	if !strings.Contains(doc.MainPart, ` descr="Sales by &#34;region&#34; &amp; {RID}" title="Sales"/>`) {
+		t.Errorf("替代文本与标题错误: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.MainPart, ` descr="chart.png"/>`) {
+		t.Errorf("未设置替代文本时应使用文件名: %s", doc.MainPart)
+	}
+	first := strings.Index(doc.MainPart, `<w:t>1</w:t></w:r></w:fldSimple><w:r><w:t xml:space="preserve">: First</w:t>`)
+	second := strings.Index(doc.MainPart, `<w:t>2</w:t></w:r></w:fldSimple><w:r><w:t xml:space="preserve">: Quarterly &lt;sales&gt;</w:t>`)
+	if first == -1 || second < first {
+		t.Errorf("题注应按出现顺序编号: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.MainPart, `</w:drawing><w:t></w:t></w:r></w:p><w:p><w:pPr><w:pStyle w:val="Caption"/></w:pPr>`) {
+		t.Errorf("题注应位于图片所在段落之后: %s", doc.MainPart)
+	}
+}
+
+func TestImageCaptionsInOneParagraph(t *testing.T) {
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{img:x}} {{img:y}}`)),
+		"word/styles.xml":   `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:style w:type="paragraph" w:styleId="a5"><w:name w:val="caption"/></w:style></w:styles>`,
+	})
+	defer doc.Close()
+
+	img := doc.GetArrangeImage(testImage(t, "chart.png", 2, 2))
+	img.Caption = "X"
+	doc.SetImagesValues("img:x", img)
+	img.Caption = "Y"
+	doc.SetImagesValues("img:y", img)
+
+	x := strings.Index(doc.MainPart, `<w:t>1</w:t></w:r></w:fldSimple><w:r><w:t xml:space="preserve">: X</w:t>`)
+	y := strings.Index(doc.MainPart, `<w:t>2</w:t></w:r></w:fldSimple><w:r><w:t xml:space="preserve">: Y</w:t>`)
+	if x == -1 || y < x {
+		t.Errorf("同一段落中的题注应按图片顺序排列: %s", doc.MainPart)
+	}
+	if strings.Count(doc.MainPart, `<w:pStyle w:val="a5"/>`) != 2 {
+		t.Errorf("题注应使用模板中题注样式的 id: %s", doc.MainPart)
+	}
+}
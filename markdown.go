@@ -0,0 +1,650 @@
+package docx
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+SetMarkdown 将标记所在的段落替换为 Markdown 转换得到的段落、表格
+
+	模板: {{md:notes}}
+	doc.SetMarkdown("md:notes", "# v1.2\n\n- **Fix** crash on `Save`\n- See [docs](https://example.com)")
+
+支持 CommonMark 的常用语法:
+
+	ATX (#) 与 Setext (=== ---) 标题，对应样式 heading 1 - heading 6
+	段落、硬换行 (行尾两个空格或 \)、反斜杠转义
+	*斜体*、**粗体**、***粗斜体***、~~删除线~~、`代码` (字符样式 HTML Code)
+	[链接](url "title")、<https://autolink>、![图片](data:...) (仅 data URI，否则输出替代文本)
+	无序、有序列表 (可嵌套)、> 引用 (可嵌套)、围栏与缩进代码块 (段落样式 HTML Preformatted)
+	分隔线、GFM 表格 (列对齐)
+
+不支持引用式链接与内嵌 HTML，这些内容按普通文本输出
+*/
+func (d *Docx) SetMarkdown(mark, md string) error {
+	return d.replaceParagraphs(mark, markdownBlocks(md))
+}
+
+var (
+	mdATXReg        = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdSetextReg     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdFenceReg      = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	mdListReg       = regexp.MustCompile(`^( {0,3})([-+*]|\d{1,9}[.)])([ \t]+|$)(.*)$`)
+	mdTableDelimReg = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	mdAutolinkReg   = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^<>\s]*)>`)
+	mdEmailReg      = regexp.MustCompile(`^<([^\s<>@]+@[^\s<>@]+)>`)
+)
+
+// markdownBlocks 将 Markdown 转换为块
+func markdownBlocks(md string) []contentBlock {
+	md = strings.Replace(strings.Replace(md, "\r\n", "\n", -1), "\r", "\n", -1)
+	md = strings.Replace(md, "\t", "    ", -1)
+	m := &markdownParser{}
+	return m.blocks(strings.Split(md, "\n"), contentBlock{})
+}
+
+// markdownParser Markdown 解析器
+type markdownParser struct {
+	lists int // 已分配的列表 id
+}
+
+// blocks 解析一组行，ctx 为新段落的模板 (样式、列表、缩进)
+func (m *markdownParser) blocks(lines []string, ctx contentBlock) []contentBlock {
+	var res []contentBlock
+	var para []string
+	add := func(style string, runs []inlineRun) {
+		p := ctx
+		if style != "" {
+			p.style = style
+		}
+		p.runs = runs
+		res = append(res, p)
+	}
+	flush := func() {
+		if len(para) > 0 {
+			if runs := m.inline(mdJoinLines(para), inlineRun{}); len(runs) > 0 {
+				add("", runs)
+			}
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		indent := mdIndent(line)
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+			i++
+
+		case indent >= 4 && len(para) == 0:
+			// 缩进代码块
+			var code []string
+			for ; i < len(lines) && (mdIndent(lines[i]) >= 4 || strings.TrimSpace(lines[i]) == ""); i++ {
+				if len(lines[i]) >= 4 {
+					code = append(code, lines[i][4:])
+				} else {
+					code = append(code, "")
+				}
+			}
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			add("HTML Preformatted", codeRuns(code))
+
+		case mdFenceReg.MatchString(line) && !(line[indent] == '`' && strings.Contains(mdFenceReg.FindStringSubmatch(line)[3], "`")):
+			flush()
+			f := mdFenceReg.FindStringSubmatch(line)
+			fence := f[2]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if l := strings.TrimSpace(lines[i]); mdIndent(lines[i]) < 4 && strings.HasPrefix(l, fence) && strings.Trim(l, fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, mdTrimIndent(lines[i], len(f[1])))
+			}
+			add("HTML Preformatted", codeRuns(code))
+
+		case len(para) > 0 && mdSetextReg.MatchString(line):
+			level := "1"
+			if strings.TrimSpace(line)[0] == '-' {
+				level = "2"
+			}
+			add("heading "+level, m.inline(mdJoinLines(para), inlineRun{}))
+			para = nil
+			i++
+
+		case mdThematicBreak(line):
+			flush()
+			p := ctx
+			p.rule = true
+			res = append(res, p)
+			i++
+
+		case mdATXReg.MatchString(line):
+			flush()
+			h := mdATXReg.FindStringSubmatch(line)
+			add("heading "+strconv.Itoa(len(h[1])), m.inline(strings.TrimSpace(h[2]), inlineRun{}))
+			i++
+
+		case indent < 4 && line[indent] == '>':
+			flush()
+			var quote []string
+			for ; i < len(lines); i++ {
+				l := lines[i]
+				if n := mdIndent(l); n < 4 && n < len(l) && l[n] == '>' {
+					l = strings.TrimPrefix(l[n+1:], " ")
+				} else if len(quote) == 0 || strings.TrimSpace(quote[len(quote)-1]) == "" || strings.TrimSpace(l) == "" || m.startsBlock(l) {
+					break
+				}
+				quote = append(quote, l)
+			}
+			q := ctx
+			if q.style == "Quote" {
+				q.indent += listIndent
+			}
+			q.style = "Quote"
+			res = append(res, m.blocks(quote, q)...)
+
+		case mdListReg.MatchString(line) && (len(para) == 0 || mdCanInterrupt(line)):
+			flush()
+			var items []contentBlock
+			items, i = m.list(lines, i, ctx)
+			res = append(res, items...)
+
+		case len(para) == 0 && i+1 < len(lines) && strings.Contains(line, "|") && mdTableDelimReg.MatchString(lines[i+1]) &&
+			len(mdSplitRow(line)) == len(mdSplitRow(lines[i+1])):
+			var table contentBlock
+			table, i = m.table(lines, i)
+			res = append(res, table)
+
+		default:
+			para = append(para, strings.TrimLeft(line, " "))
+			i++
+		}
+	}
+	flush()
+	return res
+}
+
+// startsBlock 判断一行是否开始新的块 (不能作为段落的延续)
+func (m *markdownParser) startsBlock(line string) bool {
+	indent := mdIndent(line)
+	return mdThematicBreak(line) || mdATXReg.MatchString(line) || mdFenceReg.MatchString(line) ||
+		(indent < 4 && indent < len(line) && line[indent] == '>') || (mdListReg.MatchString(line) && mdCanInterrupt(line))
+}
+
+// list 从第 i 行开始解析一个列表，返回列表项的块与列表之后的行号
+// 每一项的第一个段落带编号，其余段落与编号文字对齐
+func (m *markdownParser) list(lines []string, i int, ctx contentBlock) ([]contentBlock, int) {
+	kind := mdListKind(mdListReg.FindStringSubmatch(lines[i])[2])
+	m.lists++
+	item := listItem{id: m.lists, ordered: kind != "-" && kind != "+" && kind != "*"}
+	if ctx.list != nil {
+		item.level = ctx.list.level + 1
+	}
+	if item.ordered {
+		marker := mdListReg.FindStringSubmatch(lines[i])[2]
+		item.start, _ = strconv.Atoi(marker[:len(marker)-1])
+	}
+
+	var res []contentBlock
+	for i < len(lines) {
+		match := mdListReg.FindStringSubmatch(lines[i])
+		if match == nil || mdThematicBreak(lines[i]) || mdListKind(match[2]) != kind {
+			break
+		}
+		// 内容的缩进：标记后的空格超过 4 个时视为 1 个，其余属于内容
+		width := len(match[1]) + len(match[2]) + len(match[3])
+		content := match[4]
+		if match[3] == "" || len(match[3]) > 4 {
+			width = len(match[1]) + len(match[2]) + 1
+			if len(match[3]) > 4 {
+				content = strings.Repeat(" ", len(match[3])-1) + content
+			}
+		}
+		itemLines := []string{content}
+		for i++; i < len(lines); i++ {
+			l := lines[i]
+			blank := strings.TrimSpace(l) == ""
+			prevBlank := strings.TrimSpace(itemLines[len(itemLines)-1]) == ""
+			switch {
+			case blank:
+				itemLines = append(itemLines, "")
+				continue
+			case mdIndent(l) >= width:
+				itemLines = append(itemLines, l[width:])
+				continue
+			case !prevBlank && !m.startsBlock(l) && !mdListReg.MatchString(l):
+				// 段落的懒惰延续行
+				itemLines = append(itemLines, l)
+				continue
+			}
+			break
+		}
+
+		it := item
+		itemCtx := ctx
+		itemCtx.list, itemCtx.style, itemCtx.runs = &it, "", nil
+		first := true
+		for _, b := range m.blocks(itemLines, itemCtx) {
+			if b.list == &it {
+				if !first {
+					b.list = nil
+					b.indent = listIndent * (it.level + 1)
+				}
+				first = false
+			}
+			res = append(res, b)
+		}
+	}
+	return res, i
+}
+
+// table 从第 i 行开始解析 GFM 表格，第一行为表头，第二行为分隔行
+func (m *markdownParser) table(lines []string, i int) (contentBlock, int) {
+	header := mdSplitRow(lines[i])
+	var aligns []string
+	for _, cell := range mdSplitRow(lines[i+1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns = append(aligns, "center")
+		case right:
+			aligns = append(aligns, "right")
+		case left:
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	row := func(cells []string, bold bool) []contentCell {
+		var res []contentCell
+		for k, cell := range cells {
+			if k >= len(header) {
+				break
+			}
+			base := inlineRun{}
+			base.Bold = bold
+			p := contentBlock{align: aligns[k], runs: m.inline(cell, base)}
+			res = append(res, contentCell{blocks: []contentBlock{p}})
+		}
+		return res
+	}
+
+	t := &contentTable{header: 1}
+	t.rows = append(t.rows, row(header, true))
+	for i += 2; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !m.startsBlock(lines[i]); i++ {
+		t.rows = append(t.rows, row(mdSplitRow(lines[i]), false))
+	}
+	return contentBlock{table: t}, i
+}
+
+// inline 解析行内元素，base 为继承的格式与链接
+func (m *markdownParser) inline(s string, base inlineRun) []inlineRun {
+	p := &contentBlock{}
+	m.appendInline(p, s, base)
+	return p.runs
+}
+
+func (m *markdownParser) appendInline(p *contentBlock, s string, run inlineRun) {
+	var lit strings.Builder
+	flush := func() {
+		addText(p, run, html.UnescapeString(lit.String()))
+		lit.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && mdPunct(s[i+1]):
+			flush()
+			addText(p, run, s[i+1:i+2])
+			i += 2
+
+		case c == '\n':
+			flush()
+			addText(p, run, "\n")
+			i++
+
+		case c == '`':
+			n := mdRunLength(s, i, '`')
+			end := mdFindCodeEnd(s, i+n, n)
+			if end == -1 {
+				lit.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			flush()
+			code := strings.Replace(s[i+n:end], "\n", " ", -1)
+			if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+				code = code[1 : len(code)-1]
+			}
+			r := run
+			r.style = "HTML Code"
+			addText(p, r, code)
+			i = end + n
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			label, dest, title, end, ok := mdParseLink(s, i+1)
+			if !ok {
+				lit.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			if img, err := dataURIImage(dest); err == nil {
+				img.Description, img.Title = label, title
+				p.runs = append(p.runs, inlineRun{link: run.link, image: &img})
+			} else {
+				addText(p, run, label)
+			}
+			i = end
+
+		case c == '[':
+			label, dest, _, end, ok := mdParseLink(s, i)
+			if !ok {
+				lit.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			r := run
+			r.link = dest
+			m.appendInline(p, label, r)
+			i = end
+
+		case c == '<' && (mdAutolinkReg.MatchString(s[i:]) || mdEmailReg.MatchString(s[i:])):
+			flush()
+			r := run
+			if a := mdAutolinkReg.FindStringSubmatch(s[i:]); a != nil {
+				r.link = a[1]
+				addText(p, r, a[1])
+				i += len(a[0])
+			} else {
+				a = mdEmailReg.FindStringSubmatch(s[i:])
+				r.link = "mailto:" + a[1]
+				addText(p, r, a[1])
+				i += len(a[0])
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			n := mdRunLength(s, i, c)
+			end := -1
+			if (c != '~' || n == 2) && n <= 3 && mdCanOpen(s, i, n) {
+				end = mdFindCloser(s, i+n, c, n)
+			}
+			if end == -1 {
+				lit.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			flush()
+			r := run
+			switch {
+			case c == '~':
+				r.Strike = true
+			case n == 1:
+				r.Italic = true
+			case n == 2:
+				r.Bold = true
+			default:
+				r.Bold, r.Italic = true, true
+			}
+			m.appendInline(p, s[i+n:end], r)
+			i = end + n
+
+		default:
+			lit.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+}
+
+// mdParseLink 解析从 s[i] ('[') 开始的 [label](dest "title")，end 为其后的位置
+func mdParseLink(s string, i int) (label, dest, title string, end int, ok bool) {
+	depth, j := 0, i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s) || j+1 >= len(s) || s[j+1] != '(' {
+		return "", "", "", 0, false
+	}
+	label = s[i+1 : j]
+
+	k := j + 2
+	for k < len(s) && s[k] == ' ' {
+		k++
+	}
+	if k < len(s) && s[k] == '<' {
+		e := strings.IndexByte(s[k:], '>')
+		if e == -1 {
+			return "", "", "", 0, false
+		}
+		dest, k = s[k+1:k+e], k+e+1
+	} else {
+		start, parens := k, 0
+		for ; k < len(s) && s[k] != ' ' && s[k] != '\n'; k++ {
+			if s[k] == '(' {
+				parens++
+			} else if s[k] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		dest = s[start:k]
+	}
+	for k < len(s) && (s[k] == ' ' || s[k] == '\n') {
+		k++
+	}
+	if k < len(s) && (s[k] == '"' || s[k] == '\'' || s[k] == '(') {
+		closing := s[k]
+		if closing == '(' {
+			closing = ')'
+		}
+		e := strings.IndexByte(s[k+1:], closing)
+		if e == -1 {
+			return "", "", "", 0, false
+		}
+		title, k = s[k+1:k+1+e], k+e+2
+		for k < len(s) && s[k] == ' ' {
+			k++
+		}
+	}
+	if k >= len(s) || s[k] != ')' {
+		return "", "", "", 0, false
+	}
+	return label, html.UnescapeString(dest), html.UnescapeString(title), k + 1, true
+}
+
+// mdRunLength 返回从 i 开始连续字符 c 的个数
+func mdRunLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// mdFindCodeEnd 查找与 n 个反引号配对的结束位置，不存在时为 -1
+func mdFindCodeEnd(s string, from, n int) int {
+	for i := from; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		k := mdRunLength(s, i, '`')
+		if k == n {
+			return i
+		}
+		i += k
+	}
+	return -1
+}
+
+// mdCanOpen 判断 s[i:i+n] 的分隔符能否开始强调：其后不是空白，_ 还要求不在单词内部
+func mdCanOpen(s string, i, n int) bool {
+	if i+n >= len(s) || mdSpace(s[i+n]) {
+		return false
+	}
+	return s[i] != '_' || i == 0 || !mdWordChar(s[i-1])
+}
+
+// mdFindCloser 查找与开始分隔符配对的结束分隔符，跳过转义与行内代码
+// 优先匹配长度同为 n 的分隔符，没有时使用更长分隔符的最后 n 个字符 (如 **a *b*** )
+func mdFindCloser(s string, from int, c byte, n int) int {
+	for _, exact := range []bool{true, false} {
+		for i := from; i < len(s); {
+			switch s[i] {
+			case '\\':
+				i += 2
+				continue
+			case '`':
+				k := mdRunLength(s, i, '`')
+				if end := mdFindCodeEnd(s, i+k, k); end != -1 {
+					i = end + k
+					continue
+				}
+				i += k
+				continue
+			case c:
+				k := mdRunLength(s, i, c)
+				if (k == n || !exact && k > n) && i > from && !mdSpace(s[i-1]) && (c != '_' || i+k >= len(s) || !mdWordChar(s[i+k])) {
+					return i + k - n
+				}
+				i += k
+				continue
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// mdJoinLines 拼接段落的行，行尾两个以上空格或反斜杠为硬换行，其余换行视为空格
+func mdJoinLines(lines []string) string {
+	var sb strings.Builder
+	for k, l := range lines {
+		if k == len(lines)-1 {
+			sb.WriteString(strings.TrimRight(l, " "))
+			break
+		}
+		switch {
+		case strings.HasSuffix(l, "  "):
+			sb.WriteString(strings.TrimRight(l, " ") + "\n")
+		case strings.HasSuffix(l, `\`) && !strings.HasSuffix(l, `\\`):
+			sb.WriteString(l[:len(l)-1] + "\n")
+		default:
+			sb.WriteString(l + " ")
+		}
+	}
+	return sb.String()
+}
+
+// mdSplitRow 拆分表格行的单元格，\| 为单元格中的竖线
+func mdSplitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// codeRuns 代码块的内容，行之间为换行
+func codeRuns(code []string) []inlineRun {
+	if len(code) == 0 {
+		return nil
+	}
+	return []inlineRun{{TextSegment: TextSegment{Text: strings.Join(code, "\n")}}}
+}
+
+// mdThematicBreak 判断是否为分隔线：至少三个相同的 -、* 或 _，可以有空格
+func mdThematicBreak(line string) bool {
+	if mdIndent(line) >= 4 {
+		return false
+	}
+	s := strings.Replace(strings.TrimSpace(line), " ", "", -1)
+	if len(s) < 3 || (s[0] != '-' && s[0] != '*' && s[0] != '_') {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s)
+}
+
+// mdListKind 列表标记的类型：无序列表为标记字符，有序列表为分隔符 . 或 )
+func mdListKind(marker string) string {
+	if marker[0] >= '0' && marker[0] <= '9' {
+		return "1" + marker[len(marker)-1:]
+	}
+	return marker
+}
+
+// mdCanInterrupt 判断列表项能否打断段落：无序列表或从 1 开始的有序列表，且内容不为空
+func mdCanInterrupt(line string) bool {
+	match := mdListReg.FindStringSubmatch(line)
+	if match == nil || strings.TrimSpace(match[4]) == "" {
+		return false
+	}
+	if mdListKind(match[2])[0] == '1' {
+		return strings.TrimLeft(match[2][:len(match[2])-1], "0") == "1"
+	}
+	return true
+}
+
+// mdIndent 返回行首空格数
+func mdIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// mdTrimIndent 删除行首最多 n 个空格
+func mdTrimIndent(line string, n int) string {
+	for n > 0 && strings.HasPrefix(line, " ") {
+		line = line[1:]
+		n--
+	}
+	return line
+}
+
+func mdSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func mdWordChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// mdPunct 可以用反斜杠转义的 ASCII 标点
+func mdPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
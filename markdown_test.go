@@ -0,0 +1,88 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSetMarkdown(t *testing.T) {
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{md}}`)+testParagraph(`end`)),
+		"word/styles.xml":   testStyles,
+	})
+	defer doc.Close()
+
+	md := "# Title #\n" +
+		"Sub\n---\n\n" +
+		"Hello **bold *both***, _it_ and ~~gone~~ with `a * b`  \n" +
+		"next \\*line\\* see [docs](https://example.com/?a=1&b=2 \"Docs\") or <https://go.dev>\n\n" +
+		"- one\n  - nested\n- two\n\n  more\n\n" +
+		"3. three\n4. four\n\n" +
+		"> quoted\n> > deeper\n\n" +
+		"```go\nfmt.Println(1)\n\n  x := 2\n```\n\n" +
+		"***\n\n" +
+		"| Name | Score |\n|:-----|------:|\n| A \\| B | 10 |\n| x |\n"
+	if err := doc.SetMarkdown("md", md); err != nil {
+		t.Fatalf("插入 Markdown 失败: %v", err)
+	}
+
+	for _, want := range []string{
+		`<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t xml:space="preserve">Title</w:t></w:r></w:p>`,
+		`<w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t xml:space="preserve">Sub</w:t>`,
+		`<w:r><w:t xml:space="preserve">Hello </w:t></w:r><w:r><w:rPr><w:b/><w:bCs/></w:rPr><w:t xml:space="preserve">bold </w:t></w:r>` +
+			`<w:r><w:rPr><w:b/><w:bCs/><w:i/><w:iCs/></w:rPr><w:t xml:space="preserve">both</w:t></w:r>`,
+		`<w:rPr><w:i/><w:iCs/></w:rPr><w:t xml:space="preserve">it</w:t>`,
+		`<w:rPr><w:strike/></w:rPr><w:t xml:space="preserve">gone</w:t>`,
+		`<w:rPr><w:rStyle w:val="HTMLCode"/></w:rPr><w:t xml:space="preserve">a * b</w:t></w:r><w:r><w:br/>`,
+		`<w:t xml:space="preserve">next *line* see </w:t>`,
+		`<w:hyperlink xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:id="rId1" w:history="1"><w:r><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr><w:t xml:space="preserve">docs</w:t></w:r></w:hyperlink>`,
+		`<w:t xml:space="preserve">https://go.dev</w:t>`,
+		`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">one</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">nested</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">two</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:ind w:left="720"/></w:pPr><w:r><w:t xml:space="preserve">more</w:t></w:r></w:p>`,
+		`<w:numId w:val="3"/></w:numPr></w:pPr><w:r><w:t xml:space="preserve">four</w:t>`,
+		`<w:pStyle w:val="Quote"/></w:pPr><w:r><w:t xml:space="preserve">quoted</w:t>`,
+		`<w:pStyle w:val="Quote"/><w:ind w:left="720"/></w:pPr><w:r><w:t xml:space="preserve">deeper</w:t>`,
+		`<w:pStyle w:val="HTMLPreformatted"/></w:pPr><w:r><w:t xml:space="preserve">fmt.Println(1)</w:t><w:br/><w:br/><w:t xml:space="preserve">  x := 2</w:t>`,
+		`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr>`,
+		`<w:tr><w:trPr><w:tblHeader/></w:trPr><w:tc><w:tcPr><w:tcW w:w="4500" w:type="dxa"/></w:tcPr><w:p><w:pPr><w:jc w:val="left"/></w:pPr><w:r><w:rPr><w:b/><w:bCs/></w:rPr><w:t xml:space="preserve">Name</w:t>`,
+		`<w:p><w:pPr><w:jc w:val="right"/></w:pPr><w:r><w:t xml:space="preserve">10</w:t>`,
+		`<w:t xml:space="preserve">A | B</w:t>`,
+		`<w:t xml:space="preserve">x</w:t></w:r></w:p></w:tc><w:tc><w:tcPr><w:tcW w:w="4500" w:type="dxa"/></w:tcPr><w:p/></w:tc></w:tr>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `{{md}}`) || !strings.Contains(doc.MainPart, `<w:t>end</w:t>`) {
+		t.Errorf("应只替换占位符所在的段落: %s", doc.MainPart)
+	}
+	if numbering := doc.part(getNumberingName()); !strings.Contains(numbering, `<w:startOverride w:val="3"/>`) {
+		t.Errorf("有序列表应从 3 开始: %s", numbering)
+	}
+	if rels := doc.Relations["word/document.xml"]; !strings.Contains(rels, `Target="https://example.com/?a=1&amp;b=2" TargetMode="External"/>`) {
+		t.Errorf("应登记超链接关系: %s", rels)
+	}
+}
+
+func TestMarkdownInline(t *testing.T) {
+	for md, want := range map[string]string{
+		`snake_case_name`:        `snake_case_name`,
+		`2 * 3 * 4`:              `2 * 3 * 4`,
+		"``a ` b``":              "a ` b",
+		`**unclosed`:             `**unclosed`,
+		`[no link]`:              `[no link]`,
+		`Tom &amp; Jerry &copy;`: `Tom & Jerry ©`,
+		`![alt](missing.png)`:    `alt`,
+	} {
+		var text strings.Builder
+		for _, r := range (&markdownParser{}).inline(md, inlineRun{}) {
+			text.WriteString(r.Text)
+		}
+		if text.String() != want {
+			t.Errorf("%q: 应为 %q，实际为 %q", md, want, text.String())
+		}
+	}
+}
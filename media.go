@@ -0,0 +1,420 @@
+package docx
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrImageNotFound 文档中找不到指定替代文本或名称的图片
+var ErrImageNotFound = errors.New("docx: image not found")
+
+var (
+	docPrReg     = regexp.MustCompile(`<wp:docPr\b[^>]*>`)
+	imageDataReg = regexp.MustCompile(`<v:imagedata\b[^>]*>`)
+	attrReg      = regexp.MustCompile(`\s([\w:]+)="([^"]*)"`)
+	embedReg     = regexp.MustCompile(`\sr:embed="([^"]+)"`)
+	vmlIDReg     = regexp.MustCompile(`\sr:id="([^"]+)"`)
+	extentReg    = regexp.MustCompile(`(<(?:wp:extent|a:ext) cx=")\d+(" cy=")\d+(")`)
+	vmlSizeReg   = regexp.MustCompile(`(width|height):[^;"]*`)
+	relationReg  = regexp.MustCompile(`<Relationship\b[^>]*>`)
+	xmlnsReg     = regexp.MustCompile(`\sxmlns:([\w.-]+)="([^"]*)"`)
+)
+
+// imageRelType 图片关系的类型
+const imageRelType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+
+// 引用关系 id 的属性所在的命名空间
+const (
+	relationshipsNS       = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	strictRelationshipsNS = "http://purl.oclc.org/ooxml/officeDocument/relationships"
+	officeNS              = "urn:schemas-microsoft-com:office:office"
+)
+
+// MediaReport 保存时 media 去重与清理的结果
+type MediaReport struct {
+	Duplicates       []string // 因内容与其他 media 相同而合并删除的文件
+	Unused           []string // 因没有被任何关系引用而删除的文件
+	RemovedRelations int      // 删除的未被部件引用的图片关系数
+	BytesSaved       int64    // 删除的 media 文件总字节数
+}
+
+// imageRef 部件中引用的一张图片
+type imageRef struct {
+	start, end int    // w:drawing 或 w:pict 元素的范围
+	rid        string // 图片的关系 id
+	vml        bool
+}
+
+// ReplaceImage 替换模板中已有的图片，按 wp:docPr 的 descr、title、name 或 VML v:imagedata 的 o:title 查找
+// 图片的位置保持不变，img.KeepSize 为 true 时同时保留原尺寸，否则使用 img 的尺寸
+// 新图片的扩展名不同或原文件还被其他关系引用时，写入新的 media 文件并更新关系与 [Content_Types].xml；不支持 SVG
+func (d *Docx) ReplaceImage(altTextOrName string, img ImgValue) error {
+	data, err := img.content()
+	if err != nil {
+		return err
+	}
+	if img.Type = sniffImageType(data); img.Type == "" || img.Type == "svg" {
+		return ErrUnsupportedImage
+	}
+	if !img.KeepSize && (img.Width <= 0 || img.Height <= 0) {
+		if img.Width, img.Height, err = imageSize(data, img.Type); err != nil {
+			return err
+		}
+	}
+
+	found := false
+	err = d.updateParts(func(partName, content string) (string, error) {
+		refs := findImageRefs(content, altTextOrName)
+		// 从后往前处理，修改尺寸不影响前面元素的位置
+		for i := len(refs) - 1; i >= 0; i-- {
+			found = true
+			ref := refs[i]
+			if err := d.replaceMedia(partName, ref.rid, img.Type, data); err != nil {
+				return content, err
+			}
+			if !img.KeepSize {
+				content = content[:ref.start] + resizeImageXML(content[ref.start:ref.end], img, ref.vml) + content[ref.end:]
+			}
+		}
+		return content, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrImageNotFound, altTextOrName)
+	}
+	return nil
+}
+
+// findImageRefs 查找 content 中替代文本或名称为 name 的图片
+func findImageRefs(content, name string) []imageRef {
+	var refs []imageRef
+	find := func(reg *regexp.Regexp, tag string, attrs []string, ridReg *regexp.Regexp, vml bool) {
+		for _, loc := range reg.FindAllStringIndex(content, -1) {
+			if !hasAttrValue(content[loc[0]:loc[1]], attrs, name) {
+				continue
+			}
+			start, end := findElement(content, loc[0], tag)
+			if start == -1 {
+				continue
+			}
+			elem := content[start:end]
+			if vml {
+				elem = content[loc[0]:loc[1]]
+			}
+			if m := ridReg.FindStringSubmatch(elem); m != nil {
+				refs = append(refs, imageRef{start: start, end: end, rid: m[1], vml: vml})
+			}
+		}
+	}
+	find(docPrReg, "w:drawing", []string{"descr", "title", "name"}, embedReg, false)
+	find(imageDataReg, "w:pict", []string{"o:title"}, vmlIDReg, true)
+	return refs
+}
+
+// hasAttrValue 判断标签中 attrs 之一的值 (反转义后) 是否等于 value
+func hasAttrValue(tag string, attrs []string, value string) bool {
+	for _, m := range attrReg.FindAllStringSubmatch(tag, -1) {
+		if findStrInSlice(attrs, m[1]) != -1 && html.UnescapeString(m[2]) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue 返回标签中属性 name 的原始值
+func attrValue(tag, name string) string {
+	for _, m := range attrReg.FindAllStringSubmatch(tag, -1) {
+		if m[1] == name {
+			return m[2]
+		}
+	}
+	return ""
+}
+
+// replaceMedia 将部件 partName 中关系 rid 指向的 media 内容替换为 data
+// 扩展名与 imgType 不一致或文件还被其他关系引用时，写入新的 media 文件并只修改该关系
+func (d *Docx) replaceMedia(partName, rid, imgType string, data []byte) error {
+	rels := d.Relations[partName]
+	start, end := relationshipElement(rels, rid)
+	if start == -1 {
+		return fmt.Errorf("docx: relationship %s not found in %s", rid, partName)
+	}
+	rel := rels[start:end]
+	target, ok := relationTarget(partName, rel)
+	if !ok {
+		return fmt.Errorf("docx: relationship %s in %s is external", rid, partName)
+	}
+
+	ext := path.Ext(target)
+	if normalizeImageExt(strings.TrimPrefix(ext, ".")) != normalizeImageExt(imgType) || d.sharedTarget(partName, rid, target) {
+		target = d.uniqueMediaName(strings.TrimSuffix(target, ext) + "." + imgType)
+		rel = strings.Replace(rel, ` Target="`+attrValue(rel, "Target")+`"`, ` Target="`+escapeText(relativeTarget(partName, target))+`"`, 1)
+		d.Relations[partName] = rels[:start] + rel + rels[end:]
+		d.addDefaultContentType(imgType)
+	}
+	d.media[target] = data
+	return nil
+}
+
+// sharedTarget 判断除部件 partName 的关系 rid 之外，是否还有关系指向包内文件 target
+func (d *Docx) sharedTarget(partName, rid, target string) bool {
+	shared := false
+	d.eachRelations(d.Relations, func(owner, rels string) {
+		for _, rel := range relationReg.FindAllString(rels, -1) {
+			if owner == partName && attrValue(rel, "Id") == rid {
+				continue
+			}
+			if t, ok := relationTarget(owner, rel); ok && t == target {
+				shared = true
+			}
+		}
+	})
+	return shared
+}
+
+// eachRelations 遍历所有部件的关系，已加载的部件使用 relations 中的内容，其余读取原文档
+func (d *Docx) eachRelations(relations map[string]string, f func(owner, rels string)) {
+	for owner, rels := range relations {
+		f(owner, rels)
+	}
+	for _, file := range d.ZipBuffer.files() {
+		owner := getRemoveRelationsName(file.Name)
+		if _, loaded := relations[owner]; owner == file.Name || loaded {
+			continue
+		}
+		f(owner, d.ZipBuffer.getFromName(file.Name))
+	}
+}
+
+// mediaExists 判断包内是否已有 media 文件 name (原文档、替换写入或新增的图片)
+func (d *Docx) mediaExists(name string) bool {
+	if _, ok := d.media[name]; ok || d.ZipBuffer.locateName(name) != -1 {
+		return true
+	}
+	for _, img := range d.NewImages {
+		if "word/media/"+img.Replace == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueMediaName 返回不与已有 media 重名的包内路径，重名时在扩展名前加序号
+func (d *Docx) uniqueMediaName(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; d.mediaExists(name); i++ {
+		name = base + "_" + strconv.Itoa(i) + ext
+	}
+	return name
+}
+
+// relationshipElement 返回 Id 为 rid 的 Relationship 元素的范围，不存在时为 -1, -1
+func relationshipElement(rels, rid string) (start, end int) {
+	for _, loc := range relationReg.FindAllStringIndex(rels, -1) {
+		if attrValue(rels[loc[0]:loc[1]], "Id") == rid {
+			return loc[0], loc[1]
+		}
+	}
+	return -1, -1
+}
+
+// normalizeImageExt 统一同一格式的不同扩展名写法
+func normalizeImageExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext == "jpg" {
+		return "jpeg"
+	}
+	return ext
+}
+
+// addDefaultContentType 确保 [Content_Types].xml 中有扩展名 ext 的默认类型
+func (d *Docx) addDefaultContentType(ext string) {
+	if strings.Contains(d.ContentTypes, `<Default Extension="`+ext+`"`) {
+		return
+	}
+	xml := `<Default Extension="` + ext + `" ContentType="` + imageContentType(ext) + `"/>`
+	d.ContentTypes = strings.Replace(d.ContentTypes, `</Types>`, xml+`</Types>`, 1)
+}
+
+// resizeImageXML 将图片元素的尺寸改为 img 的尺寸
+func resizeImageXML(elem string, img ImgValue, vml bool) string {
+	if vml {
+		return vmlSizeReg.ReplaceAllStringFunc(elem, func(s string) string {
+			if strings.HasPrefix(s, "width") {
+				return "width:" + strconv.Itoa(img.Width) + "px"
+			}
+			return "height:" + strconv.Itoa(img.Height) + "px"
+		})
+	}
+	cx := strconv.FormatInt(int64(img.Width)*emuPerPixel, 10)
+	cy := strconv.FormatInt(int64(img.Height)*emuPerPixel, 10)
+	return extentReg.ReplaceAllString(elem, `${1}`+cx+`${2}`+cy+`${3}`)
+}
+
+// MediaReport 返回最近一次保存时 media 去重与清理的结果
+func (d *Docx) MediaReport() MediaReport {
+	return d.report
+}
+
+// isMediaName 判断是否为 word/media 中的文件
+func isMediaName(name string) bool {
+	return strings.HasPrefix(name, "word/media/")
+}
+
+// prepareMedia 保存前整理 media，返回需要写入的 media 文件以及整理后的关系与 [Content_Types].xml
+// 整理结果只用于本次写入，不修改文档本身
+/*
+	1. 删除主体、页眉、页脚中没有被引用的图片关系 (如占位符未能替换时已登记的图片)
+	2. 内容哈希相同的 media 只保留一份，已加载部件的关系改为指向保留的文件
+	3. 删除不再被任何关系引用的 media 及其内容类型
+*/
+func (d *Docx) prepareMedia() (files map[string][]byte, relations map[string]string, contentTypes string, err error) {
+	files = make(map[string][]byte)
+	for _, f := range d.ZipBuffer.files() {
+		if isMediaName(f.Name) {
+			files[f.Name] = []byte(d.ZipBuffer.getFromName(f.Name))
+		}
+	}
+	for _, img := range d.NewImages {
+		data, err := img.content()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		files["word/media/"+img.Replace] = data
+	}
+	for name, data := range d.media {
+		files[name] = data
+	}
+
+	relations = make(map[string]string, len(d.Relations))
+	for owner, rels := range d.Relations {
+		relations[owner] = rels
+	}
+	report := MediaReport{}
+	d.eachPart(func(partName, content string) error {
+		rels := relations[partName]
+		if rels == "" {
+			return nil
+		}
+		refs, ok := relationRefs(content)
+		if !ok {
+			return nil
+		}
+		relations[partName] = relationReg.ReplaceAllStringFunc(rels, func(rel string) string {
+			if attrValue(rel, "Type") == imageRelType && !refs[attrValue(rel, "Id")] {
+				report.RemovedRelations++
+				return ""
+			}
+			return rel
+		})
+		return nil
+	})
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	kept := make(map[[sha256.Size]byte]string)
+	alias := make(map[string]string)
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		if first, ok := kept[sum]; ok {
+			alias[name] = first
+		} else {
+			kept[sum] = name
+		}
+	}
+
+	for owner, rels := range relations {
+		relations[owner] = relationReg.ReplaceAllStringFunc(rels, func(rel string) string {
+			if target, ok := relationTarget(owner, rel); ok {
+				if first, dup := alias[target]; dup {
+					rel = strings.Replace(rel, ` Target="`+attrValue(rel, "Target")+`"`, ` Target="`+escapeText(relativeTarget(owner, first))+`"`, 1)
+				}
+			}
+			return rel
+		})
+	}
+	// 未加载的部件 (如词汇表) 的关系只统计引用，不做修改
+	used := make(map[string]bool)
+	d.eachRelations(relations, func(owner, rels string) {
+		for _, rel := range relationReg.FindAllString(rels, -1) {
+			if target, ok := relationTarget(owner, rel); ok {
+				used[target] = true
+			}
+		}
+	})
+
+	contentTypes = d.ContentTypes
+	for _, name := range names {
+		if used[name] {
+			continue
+		}
+		if _, dup := alias[name]; dup {
+			report.Duplicates = append(report.Duplicates, name)
+		} else {
+			report.Unused = append(report.Unused, name)
+		}
+		report.BytesSaved += int64(len(files[name]))
+		delete(files, name)
+		reg := regexp.MustCompile(`<Override PartName="/` + regexp.QuoteMeta(name) + `"[^>]*>`)
+		contentTypes = reg.ReplaceAllString(contentTypes, "")
+	}
+	d.report = report
+	return files, relations, contentTypes, nil
+}
+
+// relationRefs 返回部件中引用的关系 id，按命名空间识别属性 (如 r:embed、r:id、o:relid)，不依赖前缀的写法
+// 部件没有声明关系命名空间时无法判断，ok 为 false
+func relationRefs(content string) (refs map[string]bool, ok bool) {
+	var attrs []string
+	for _, m := range xmlnsReg.FindAllStringSubmatch(content, -1) {
+		switch m[2] {
+		case relationshipsNS, strictRelationshipsNS:
+			attrs = append(attrs, regexp.QuoteMeta(m[1])+`:\w+`)
+			ok = true
+		case officeNS:
+			attrs = append(attrs, regexp.QuoteMeta(m[1])+`:relid`)
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	refs = make(map[string]bool)
+	reg := regexp.MustCompile(`\s(?:` + strings.Join(attrs, "|") + `)="([^"]+)"`)
+	for _, m := range reg.FindAllStringSubmatch(content, -1) {
+		refs[m[1]] = true
+	}
+	return refs, true
+}
+
+// relationTarget 返回关系指向的包内路径，外部链接时 ok 为 false
+func relationTarget(owner, rel string) (target string, ok bool) {
+	if attrValue(rel, "TargetMode") == "External" {
+		return "", false
+	}
+	target = html.UnescapeString(attrValue(rel, "Target"))
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/"), true
+	}
+	return path.Join(path.Dir(owner), target), true
+}
+
+// relativeTarget 返回部件 owner 指向包内文件 name 的关系路径
+func relativeTarget(owner, name string) string {
+	if dir := path.Dir(owner) + "/"; strings.HasPrefix(name, dir) {
+		return strings.TrimPrefix(name, dir)
+	}
+	return "/" + name
+}
@@ -0,0 +1,121 @@
+package docx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// fixBrokenMacros 修复被 Word 拆分到多个 run 中的占位符
+/*
+	Word 会因拼写检查、修订或格式变化把 {{name}} 拆成多个 run，
+	这里把占位符跨越的文本合并到第一个 run (沿用其 w:rPr)，
+	只删除因此变空的 w:t 和 run，w:proofErr、书签等其他元素保持不变。
+	处理主体、页眉、页脚、脚注和尾注，无法解析的部件保持原样
+*/
+func (d *Docx) fixBrokenMacros() {
+	reg := brokenMacroReg(d.Config.PlaceholderPrefix, d.Config.PlaceholderSuffix)
+	if reg == nil {
+		return
+	}
+	d.updateParts(func(_, content string) (string, error) {
+		root, err := parseXML(content)
+		if err != nil {
+			return content, nil
+		}
+		changed := false
+		for _, p := range root.elements("w:p") {
+			if mergeRuns(p, reg) {
+				changed = true
+			}
+		}
+		if !changed {
+			return content, nil
+		}
+		return root.String(), nil
+	})
+}
+
+// brokenMacroReg 匹配转义后的占位符，内容中不能再出现前缀的第一个字符，避免从孤立的前缀一直匹配到后面的占位符
+func brokenMacroReg(prefix, suffix string) *regexp.Regexp {
+	prefix, suffix = escapeText(prefix), escapeText(suffix)
+	if prefix == "" || suffix == "" {
+		return nil
+	}
+	first := regexp.QuoteMeta(prefix[:1])
+	return regexp.MustCompile(regexp.QuoteMeta(prefix) + `[^` + first + `]*?` + regexp.QuoteMeta(suffix))
+}
+
+// mergeRuns 合并段落 p 中跨越多个 w:t 的占位符，返回是否有修改
+func mergeRuns(p *node, reg *regexp.Regexp) bool {
+	// 只处理直接属于该段落的文本，文本框等嵌套段落单独处理
+	var texts []*node
+	var sb strings.Builder
+	var owner []int // 拼接后每个字节所属的 w:t
+	for _, t := range p.elements("w:t") {
+		if t.ancestor("w:p") != p {
+			continue
+		}
+		raw := t.innerText()
+		for i := 0; i < len(raw); i++ {
+			owner = append(owner, len(texts))
+		}
+		sb.WriteString(raw)
+		texts = append(texts, t)
+	}
+	if len(texts) < 2 {
+		return false
+	}
+
+	changed := false
+	for _, m := range reg.FindAllStringIndex(sb.String(), -1) {
+		start, end := m[0], m[1]
+		if owner[start] == owner[end-1] {
+			continue
+		}
+		// 占位符的所有字节归第一个 w:t，归属仍然单调不减，每个 w:t 的新内容是连续的一段
+		for i := start; i < end; i++ {
+			owner[i] = owner[start]
+		}
+		changed = true
+	}
+	if !changed {
+		return false
+	}
+
+	all := sb.String()
+	from := 0
+	for i, t := range texts {
+		to := from
+		for to < len(all) && owner[to] == i {
+			to++
+		}
+		raw := all[from:to]
+		from = to
+		if raw == t.innerText() {
+			continue
+		}
+		if raw == "" {
+			removeText(t)
+			continue
+		}
+		t.children = nil
+		t.append(&node{typ: textNode, text: raw})
+		preserveSpace(t)
+	}
+	return true
+}
+
+// removeText 删除变空的 w:t，run 中只剩 w:rPr 时删除整个 run
+func removeText(t *node) {
+	r := t.parent
+	t.remove()
+	if r == nil || r.name != "w:r" {
+		return
+	}
+	for _, c := range r.children {
+		if c.typ == elementNode && c.name != "w:rPr" {
+			return
+		}
+	}
+	r.remove()
+}
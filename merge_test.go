@@ -0,0 +1,48 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFixBrokenMacros(t *testing.T) {
+	broken := `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>Hi {{na</w:t></w:r><w:proofErr w:type="spellStart"/>` +
+		`<w:r><w:rPr><w:i/></w:rPr><w:t>me}} and</w:t></w:r><w:bookmarkStart w:id="0" w:name="x"/>` +
+		`<w:r><w:t>{{</w:t></w:r><w:r><w:t>age}}</w:t></w:r><w:bookmarkEnd w:id="0"/></w:p>`
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml":  fmt.Sprintf(testDocumentTpl, broken),
+		"word/header1.xml":   `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` + broken + `</w:hdr>`,
+		"word/footnotes.xml": `<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:footnote w:id="1">` + broken + `</w:footnote></w:footnotes>`,
+	})
+	defer doc.Close()
+
+	want := `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Hi {{name}}</w:t></w:r><w:proofErr w:type="spellStart"/>` +
+		`<w:r><w:rPr><w:i/></w:rPr><w:t xml:space="preserve"> and</w:t></w:r><w:bookmarkStart w:id="0" w:name="x"/>` +
+		`<w:r><w:t xml:space="preserve">{{age}}</w:t></w:r><w:bookmarkEnd w:id="0"/></w:p>`
+	for name, part := range map[string]string{"main": doc.MainPart, "header": doc.Headers[1], "footnotes": doc.Footnotes} {
+		if !strings.Contains(part, want) {
+			t.Errorf("%s 中的占位符未正确合并: %s", name, part)
+		}
+	}
+
+	if err := doc.SetValue("name", "Alice"); err != nil {
+		t.Fatalf("替换失败: %v", err)
+	}
+	if !strings.Contains(doc.Footnotes, `Hi Alice</w:t>`) {
+		t.Errorf("脚注中的占位符应被替换: %s", doc.Footnotes)
+	}
+}
+
+func TestFixBrokenMacrosSingleCharDelimiters(t *testing.T) {
+	d := &Docx{
+		MainPart: `<w:body><w:p><w:r><w:t>a { b </w:t></w:r><w:r><w:t>{x</w:t></w:r><w:r><w:rPr><w:u/></w:rPr><w:t>}</w:t></w:r></w:p></w:body>`,
+		Config:   Config{PlaceholderPrefix: "{", PlaceholderSuffix: "}"},
+	}
+	d.fixBrokenMacros()
+
+	want := `<w:body><w:p><w:r><w:t>a { b </w:t></w:r><w:r><w:t xml:space="preserve">{x}</w:t></w:r></w:p></w:body>`
+	if d.MainPart != want {
+		t.Errorf("单字符分隔符合并错误: %s", d.MainPart)
+	}
+}
@@ -0,0 +1,336 @@
+package docx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nodeType 文档树节点的类型
+type nodeType int
+
+const (
+	documentNode nodeType = iota // 根节点，只有子节点
+	elementNode                  // 元素
+	textNode                     // 字符数据，保留原始的转义形式
+	otherNode                    // XML 声明、注释、CDATA、DOCTYPE 等，原样保留
+)
+
+// node 文档树的节点
+/*
+	元素保留原始的开始、结束标签 (属性顺序、命名空间前缀、空白不变)，
+	未被修改的部分序列化后与原文逐字节一致，未知元素也能无损往返
+*/
+type node struct {
+	typ      nodeType
+	name     string // 元素的限定名，如 w:p
+	open     string // 原始开始标签，自闭合元素为完整标签
+	close    string // 原始结束标签，自闭合元素为空
+	text     string // 文本或其他节点的原始内容
+	parent   *node
+	children []*node
+}
+
+// parseXML 将 XML 解析为文档树
+func parseXML(s string) (*node, error) {
+	root := &node{typ: documentNode}
+	cur := root
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			j := strings.IndexByte(s[i:], '<')
+			if j == -1 {
+				j = len(s) - i
+			}
+			cur.appendParsed(&node{typ: textNode, text: s[i : i+j]})
+			i += j
+			continue
+		}
+
+		var end string
+		switch {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end = "-->"
+		case strings.HasPrefix(s[i:], "<![CDATA["):
+			end = "]]>"
+		case strings.HasPrefix(s[i:], "<?"):
+			end = "?>"
+		case strings.HasPrefix(s[i:], "<!"):
+			end = ">"
+		}
+		if end != "" {
+			j := strings.Index(s[i:], end)
+			if j == -1 {
+				return nil, fmt.Errorf("docx: unterminated markup at offset %d", i)
+			}
+			cur.appendParsed(&node{typ: otherNode, text: s[i : i+j+len(end)]})
+			i += j + len(end)
+			continue
+		}
+
+		j := tagEnd(s, i)
+		if j == -1 {
+			return nil, fmt.Errorf("docx: unterminated tag at offset %d", i)
+		}
+		tag := s[i:j]
+		if strings.HasPrefix(tag, "</") {
+			name := strings.TrimSpace(tag[2 : len(tag)-1])
+			if cur.typ != elementNode || cur.name != name {
+				return nil, fmt.Errorf("docx: unexpected </%s> at offset %d", name, i)
+			}
+			cur.close = tag
+			cur = cur.parent
+		} else {
+			n := &node{typ: elementNode, name: tagName(tag), open: tag}
+			cur.appendParsed(n)
+			if !strings.HasSuffix(tag, "/>") {
+				cur = n
+			}
+		}
+		i = j
+	}
+	if cur != root {
+		return nil, fmt.Errorf("docx: element <%s> is not closed", cur.name)
+	}
+	return root, nil
+}
+
+// appendParsed 解析时添加子节点，此时结束标签尚未读到，不能改写开始标签
+func (n *node) appendParsed(c *node) {
+	c.parent = n
+	n.children = append(n.children, c)
+}
+
+// parseFragment 解析 XML 片段，返回顶层节点
+func parseFragment(s string) ([]*node, error) {
+	root, err := parseXML(s)
+	if err != nil {
+		return nil, err
+	}
+	nodes := root.children
+	for _, n := range nodes {
+		n.parent = nil
+	}
+	return nodes, nil
+}
+
+// tagEnd 返回从 i 开始的标签的结束位置 (> 之后)，忽略属性值中的 >
+func tagEnd(s string, i int) int {
+	var quote byte
+	for j := i + 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// tagName 返回开始或结束标签中的元素名
+func tagName(tag string) string {
+	name := strings.TrimLeft(tag, "</")
+	if i := strings.IndexAny(name, " \t\r\n/>"); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
+
+// String 序列化节点及其子节点
+func (n *node) String() string {
+	var sb strings.Builder
+	n.write(&sb)
+	return sb.String()
+}
+
+func (n *node) write(sb *strings.Builder) {
+	switch n.typ {
+	case textNode, otherNode:
+		sb.WriteString(n.text)
+		return
+	case elementNode:
+		sb.WriteString(n.open)
+	}
+	for _, c := range n.children {
+		c.write(sb)
+	}
+	sb.WriteString(n.close)
+}
+
+// expand 自闭合元素添加子节点前改为开始、结束标签的形式
+func (n *node) expand() {
+	if n.typ == elementNode && n.close == "" {
+		n.open = strings.TrimRight(strings.TrimSuffix(n.open, "/>"), " \t\r\n") + ">"
+		n.close = "</" + n.name + ">"
+	}
+}
+
+// append 添加子节点
+func (n *node) append(children ...*node) {
+	n.insert(len(n.children), children...)
+}
+
+// insert 在第 i 个子节点之前插入节点
+func (n *node) insert(i int, children ...*node) {
+	if len(children) == 0 {
+		return
+	}
+	n.expand()
+	for _, c := range children {
+		c.parent = n
+	}
+	rest := append(children[:len(children):len(children)], n.children[i:]...)
+	n.children = append(n.children[:i], rest...)
+}
+
+// index 返回节点在父节点中的位置，没有父节点时为 -1
+func (n *node) index() int {
+	if n.parent != nil {
+		for i, c := range n.parent.children {
+			if c == n {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// insertAfter 在节点之后插入兄弟节点
+func (n *node) insertAfter(nodes ...*node) {
+	n.parent.insert(n.index()+1, nodes...)
+}
+
+// replaceWith 用 nodes 替换节点，nodes 为空时即删除
+func (n *node) replaceWith(nodes ...*node) {
+	p, i := n.parent, n.index()
+	if i == -1 {
+		return
+	}
+	p.children = append(p.children[:i], p.children[i+1:]...)
+	n.parent = nil
+	p.insert(i, nodes...)
+}
+
+// remove 从树中删除节点
+func (n *node) remove() {
+	n.replaceWith()
+}
+
+// clone 深复制节点，副本没有父节点
+func (n *node) clone() *node {
+	c := *n
+	c.parent = nil
+	c.children = make([]*node, len(n.children))
+	for i, child := range n.children {
+		child = child.clone()
+		child.parent = &c
+		c.children[i] = child
+	}
+	return &c
+}
+
+// walk 先序遍历，f 返回 false 时不再进入该节点的子节点
+func (n *node) walk(f func(*node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range append([]*node(nil), n.children...) {
+		c.walk(f)
+	}
+}
+
+// findAll 按文档顺序返回所有满足 f 的后代节点 (包括自身)
+func (n *node) findAll(f func(*node) bool) []*node {
+	var res []*node
+	n.walk(func(c *node) bool {
+		if f(c) {
+			res = append(res, c)
+		}
+		return true
+	})
+	return res
+}
+
+// elements 按文档顺序返回名为 name 的所有后代元素
+func (n *node) elements(name string) []*node {
+	return n.findAll(func(c *node) bool {
+		return c.typ == elementNode && c.name == name
+	})
+}
+
+// ancestor 返回最近的名为 name 的祖先元素，不存在时为 nil
+func (n *node) ancestor(name string) *node {
+	for p := n.parent; p != nil; p = p.parent {
+		if p.typ == elementNode && p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// attached 判断节点是否仍在 root 的树中
+func (n *node) attached(root *node) bool {
+	for p := n; p != nil; p = p.parent {
+		if p == root {
+			return true
+		}
+	}
+	return false
+}
+
+// attr 返回元素属性 name 的原始值
+func (n *node) attr(name string) string {
+	return attrValue(n.open, name)
+}
+
+// texts 按文档顺序返回原始内容包含 s 的文本节点
+func (n *node) texts(s string) []*node {
+	return n.findAll(func(c *node) bool {
+		return c.typ == textNode && strings.Contains(c.text, s)
+	})
+}
+
+// innerText 返回所有文本节点原始内容的拼接
+func (n *node) innerText() string {
+	var sb strings.Builder
+	n.walk(func(c *node) bool {
+		if c.typ == textNode {
+			sb.WriteString(c.text)
+		}
+		return true
+	})
+	return sb.String()
+}
+
+// newTextElement 创建与 t 同名同属性的元素 (通常为 w:t)，内容为原始文本 raw
+func newTextElement(t *node, raw string) *node {
+	e := &node{typ: elementNode, name: t.name, open: t.open, close: t.close}
+	e.expand()
+	e.append(&node{typ: textNode, text: raw})
+	return e
+}
+
+// preserveSpace 为已展开的 w:t 加上 xml:space="preserve"，保留首尾空格
+func preserveSpace(t *node) {
+	if t.attr("xml:space") == "" {
+		t.open = strings.TrimSuffix(t.open, ">") + ` xml:space="preserve">`
+	}
+}
+
+// updateTrees 依次解析主体、页眉和页脚为文档树交给 f 处理，f 返回 true 时重新序列化该部件
+func (d *Docx) updateTrees(f func(partName string, root *node) (bool, error)) error {
+	return d.updateParts(func(partName, content string) (string, error) {
+		root, err := parseXML(content)
+		if err != nil {
+			return content, fmt.Errorf("failed to parse %s: %w", partName, err)
+		}
+		changed, err := f(partName, root)
+		if err != nil || !changed {
+			return content, err
+		}
+		return root.String(), nil
+	})
+}
@@ -0,0 +1,76 @@
+package docx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseXMLRoundTrip(t *testing.T) {
+	src := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\r\n" +
+		`<w:document xmlns:w="urn:w" xmlns:x="urn:x"><!-- note --><w:body >` +
+		`<w:p w:rsidR="00AB" ><w:r><w:t xml:space='preserve'> a &amp; b </w:t></w:r><x:unknown a="1>2"><![CDATA[<raw>]]></x:unknown></w:p>` +
+		`<w:tbl><w:tr><w:tc><w:tbl><w:tr><w:tc><w:p/></w:tc></w:tr></w:tbl><w:p/></w:tc></w:tr></w:tbl>` +
+		`<w:sectPr/></w:body ></w:document>`
+	root, err := parseXML(src)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if got := root.String(); got != src {
+		t.Errorf("序列化结果应与原文一致:\n%s\n%s", src, got)
+	}
+	if rows := root.elements("w:tr"); len(rows) != 2 || rows[1].ancestor("w:tr") != rows[0] {
+		t.Error("嵌套表格的行解析错误")
+	}
+	if u := root.elements("x:unknown"); len(u) != 1 || u[0].attr("a") != "1>2" {
+		t.Error("未知元素解析错误")
+	}
+
+	for _, bad := range []string{`<w:p><w:r></w:p>`, `<w:p>`, `<w:p a="1`} {
+		if _, err := parseXML(bad); err == nil {
+			t.Errorf("%s 应解析失败", bad)
+		}
+	}
+}
+
+func TestNodeEdit(t *testing.T) {
+	root, _ := parseXML(`<w:p><w:r><w:br/></w:r></w:p>`)
+	br := root.elements("w:br")[0]
+	br.append(&node{typ: textNode, text: "x"})
+	r := root.elements("w:r")[0]
+	c := r.clone()
+	r.insertAfter(c)
+	c.elements("w:br")[0].remove()
+	if got := root.String(); got != `<w:p><w:r><w:br>x</w:br></w:r><w:r></w:r></w:p>` {
+		t.Errorf("节点编辑结果错误: %s", got)
+	}
+}
+
+func TestSetValueOnTree(t *testing.T) {
+	doc := newTestDocx(t, `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>Hi {{name}}!</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:drawing><wp:docPr id="1" name="a" descr="{{name}}"/></w:drawing></w:r></w:p>`)
+	defer doc.Close()
+
+	if err := doc.SetValue("name", "A\r\nB"); err != nil {
+		t.Fatal(err)
+	}
+	want := `<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Hi A</w:t><w:br/><w:t xml:space="preserve">B!</w:t></w:r>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("换行应拆分为 w:t 与 w:br: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.MainPart, `descr="{{name}}"`) {
+		t.Errorf("属性值不应被替换: %s", doc.MainPart)
+	}
+}
+
+func TestSetValueMapOnTree(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{a}}-{{b}}`)+`<w:p><w:fldSimple w:instr="{{a}}"/></w:p>`)
+	defer doc.Close()
+
+	if err := doc.SetValue(map[string]string{"a": "1\r\n2", "b": "<3>"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<w:t xml:space="preserve">1</w:t><w:br/><w:t xml:space="preserve">2-&lt;3&gt;</w:t>`
+	if !strings.Contains(doc.MainPart, want) || !strings.Contains(doc.MainPart, `w:instr="{{a}}"`) {
+		t.Errorf("同一文本中的多个键替换错误: %s", doc.MainPart)
+	}
+}
@@ -0,0 +1,89 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrPlaceholderNotFound 文档中找不到指定的占位符
+var ErrPlaceholderNotFound = errors.New("docx: placeholder not found")
+
+// PlaceholderError 占位符检查结果
+type PlaceholderError struct {
+	Missing map[string][]string // 各部件 (main、header1、footer1 ...) 中仍未填充的占位符
+	Extra   []string            // 传入但未匹配任何占位符的键
+}
+
+func (e *PlaceholderError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		names := make([]string, 0, len(e.Missing))
+		for name := range e.Missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		missing := make([]string, 0, len(names))
+		for _, name := range names {
+			missing = append(missing, name+"["+strings.Join(e.Missing[name], ", ")+"]")
+		}
+		parts = append(parts, "unresolved placeholders: "+strings.Join(missing, " "))
+	}
+	if len(e.Extra) > 0 {
+		parts = append(parts, "unused keys: "+strings.Join(e.Extra, ", "))
+	}
+	return fmt.Sprintf("docx: %s", strings.Join(parts, "; "))
+}
+
+// Placeholders 列出各部件中的占位符 (去掉前后缀、去重，按出现顺序)，键为 main、header1、footer1 ...
+// 只读取部件，不修改文档
+func (d *Docx) Placeholders() (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := d.eachPart(func(partName, content string) error {
+		var names []string
+		seen := make(map[string]bool)
+		for _, name := range d.getVariablesForPart(content) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			res[d.partKey(partName)] = names
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Unresolved 检查仍未填充的占位符以及传入 SetValue 但未匹配任何占位符的键
+// 都不存在时返回 nil，否则返回 *PlaceholderError
+func (d *Docx) Unresolved() error {
+	missing, err := d.Placeholders()
+	if err != nil {
+		return err
+	}
+	extra := make([]string, 0, len(d.unusedKeys))
+	for key := range d.unusedKeys {
+		extra = append(extra, key)
+	}
+	sort.Strings(extra)
+
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	return &PlaceholderError{Missing: missing, Extra: extra}
+}
+
+// partKey 部件在报告中的名称，如 main、header1、footer1
+func (d *Docx) partKey(partName string) string {
+	if partName == d.MainPartName {
+		return "main"
+	}
+	return strings.TrimSuffix(path.Base(partName), path.Ext(partName))
+}
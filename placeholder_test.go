@@ -0,0 +1,71 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, testParagraph(`{{name}} {{date}} {{name}}`)),
+		"word/header1.xml":  `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` + testParagraph(`{{title}}`) + `</w:hdr>`,
+	})
+	defer doc.Close()
+	doc.Config.Strict = true
+
+	want := map[string][]string{"main": {"name", "date"}, "header1": {"title"}}
+	if got, err := doc.Placeholders(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("占位符列表错误: %v", got)
+	}
+
+	var perr *PlaceholderError
+	err := doc.SetValue(map[string]string{"name": "A", "unknown": "B"})
+	if !errors.As(err, &perr) || !reflect.DeepEqual(perr.Extra, []string{"unknown"}) {
+		t.Errorf("严格模式下应返回多余的键: %v", err)
+	}
+
+	if _, err = doc.SaveToBuffer(); !errors.As(err, &perr) {
+		t.Fatalf("严格模式下存在未填充占位符时应拒绝保存: %v", err)
+	}
+	want = map[string][]string{"main": {"date"}, "header1": {"title"}}
+	if !reflect.DeepEqual(perr.Missing, want) {
+		t.Errorf("未填充的占位符错误: %v", perr.Missing)
+	}
+}
+
+func TestUnusedKeyClearedAndStrictSaveToFile(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{name}}`))
+	defer doc.Close()
+
+	if err := doc.SetValue("missing", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.SetValue("name", "A"); err != nil {
+		t.Fatal(err)
+	}
+	doc.MainPart = strings.Replace(doc.MainPart, `A`, `{{missing}}`, 1)
+	if err := doc.SetValue("missing", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Unresolved(); err != nil {
+		t.Errorf("再次匹配成功的键不应报告为未使用: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "out.docx")
+	if err := ioutil.WriteFile(file, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc.Config.Strict = true
+	doc.MainPart = strings.Replace(doc.MainPart, `B`, `{{date}}`, 1)
+	if err := doc.SaveToFile(file); err == nil {
+		t.Fatal("严格模式下存在未填充占位符时应拒绝保存")
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != "existing" {
+		t.Errorf("检查失败时不应覆盖已有文件: %q", data)
+	}
+}
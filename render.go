@@ -0,0 +1,327 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeFormat Config.TimeFormat 为空时使用的时间格式
+const defaultTimeFormat = "2006-01-02"
+
+/*
+Render 使用结构体或 map 渲染模板
+
+	{{customer.name}}                    点号分隔的路径
+	{{#if paid}} ... {{/if}}             条件块
+	{{#each items}} {{name}} {{/each}}   循环块，块内优先在当前元素中查找，其次向外层查找
+	{{.}} 或 {{this}}                    当前元素本身，用于字符串切片等
+
+结构体字段名可通过 `docx:"name"` 标签指定，`docx:"-"` 表示忽略该字段，匿名嵌入的结构体字段会被展开。
+数字、布尔值按字面格式化，time.Time 按 Config.TimeFormat 格式化，实现了 fmt.Stringer 的值使用 String()。
+RichText 值替换为富文本，换行与属性值的处理同 SetValue (属性值中的占位符保持不变)。
+未找到对应值的占位符保持不变。
+*/
+func (d *Docx) Render(data interface{}) error {
+	root := indirect(reflect.ValueOf(data))
+	if root.Kind() != reflect.Struct && root.Kind() != reflect.Map {
+		return errors.New("docx: Render expects a struct or a map")
+	}
+	return d.updateParts(func(partName, content string) (string, error) {
+		r := &renderer{d: d}
+		s, err := r.content(content, []reflect.Value{root})
+		if err != nil {
+			return content, err
+		}
+		return r.fill(partName, r.restore(s))
+	})
+}
+
+// renderer 一次渲染的状态
+type renderer struct {
+	d *Docx
+	// 已渲染完成的循环块内容，在内容中以 \x00序号\x00 占位，避免被后续的块或占位符再次处理
+	done []string
+	// 占位符的值，在内容中以 \x01序号\x01 占位，渲染完成后在文档树中替换
+	reps []replacement
+	// 与 reps 对应的原占位符，未被替换 (如位于属性值中) 时恢复
+	placeholders []string
+}
+
+// content 在作用域链 scope 下渲染一段内容
+// 块按出现顺序依次处理: 条件块就地保留或删除后继续向后查找，
+// 因此同一段落或同一表格行中的多个块互不影响
+func (r *renderer) content(content string, scope []reflect.Value) (string, error) {
+	d := r.d
+	prefix := regexp.QuoteMeta(d.Config.PlaceholderPrefix)
+	suffix := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
+	openReg := regexp.MustCompile(prefix + `#(if|each)\s+(.*?)` + suffix)
+
+	cursor := 0
+	for {
+		loc := openReg.FindStringSubmatchIndex(content[cursor:])
+		if loc == nil {
+			break
+		}
+		kind := content[cursor+loc[2] : cursor+loc[3]]
+		name := strings.TrimSpace(content[cursor+loc[4] : cursor+loc[5]])
+		b, _, err := d.findBlock(content, kind, name, cursor+loc[0])
+		if err != nil {
+			return content, err
+		}
+		start, end, inner, err := blockRegion(content, b)
+		if err != nil {
+			return content, err
+		}
+
+		value, _ := lookup(scope, name)
+		if kind == "if" {
+			if !isTruthy(valueInterface(value)) {
+				inner = ""
+			}
+			// 保留的内容仍在当前作用域中，继续从块的位置向后处理
+			content = content[:start] + inner + content[end:]
+			cursor = start
+			continue
+		}
+		var sb strings.Builder
+		for _, item := range eachItems(value) {
+			s, err := r.content(inner, append(scope[:len(scope):len(scope)], item))
+			if err != nil {
+				return content, err
+			}
+			sb.WriteString(s)
+		}
+		token := r.protect(sb.String())
+		content = content[:start] + token + content[end:]
+		cursor = start + len(token)
+	}
+	return r.values(content, scope), nil
+}
+
+// protect 记录已渲染完成的内容，返回其占位文本
+func (r *renderer) protect(s string) string {
+	r.done = append(r.done, s)
+	return "\x00" + strconv.Itoa(len(r.done)-1) + "\x00"
+}
+
+// restore 将占位文本替换回渲染完成的内容，后记录的内容可能包含先记录的占位文本
+func (r *renderer) restore(s string) string {
+	for i := len(r.done) - 1; i >= 0; i-- {
+		s = strings.Replace(s, "\x00"+strconv.Itoa(i)+"\x00", r.done[i], 1)
+	}
+	return s
+}
+
+// fill 在文档树的文本中将占位文本替换为对应的值，其余位置的恢复为原占位符
+func (r *renderer) fill(partName, content string) (string, error) {
+	return fillTokens(partName, content, r.reps, r.placeholders)
+}
+
+// valueToken 第 i 个值的占位文本
+func valueToken(i int) string {
+	return "\x01" + strconv.Itoa(i) + "\x01"
+}
+
+// fillTokens 在文档树的文本中将 reps 的占位文本替换为对应的值 (换行的处理同 SetValue)
+// 位于属性值等文本以外位置的占位文本恢复为 placeholders 中对应的占位符
+func fillTokens(partName, content string, reps []replacement, placeholders []string) (string, error) {
+	if len(reps) == 0 || !strings.Contains(content, "\x01") {
+		return content, nil
+	}
+	root, err := parseXML(content)
+	if err != nil {
+		return content, fmt.Errorf("failed to parse %s: %w", partName, err)
+	}
+	replaceInTree(root, reps, make([]int, len(reps)))
+	content = root.String()
+	for i, rep := range reps {
+		content = strings.Replace(content, rep.search, placeholders[i], -1)
+	}
+	return content, nil
+}
+
+// values 将内容中的普通占位符替换为占位文本，并记录对应的值
+func (r *renderer) values(content string, scope []reflect.Value) string {
+	d := r.d
+	prefix := regexp.QuoteMeta(d.Config.PlaceholderPrefix)
+	suffix := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
+	reg := regexp.MustCompile(prefix + `(.*?)` + suffix)
+
+	return reg.ReplaceAllStringFunc(content, func(s string) string {
+		name := strings.TrimSpace(reg.FindStringSubmatch(s)[1])
+		if strings.HasPrefix(name, "#") || strings.HasPrefix(name, "/") {
+			return s
+		}
+		v, ok := lookup(scope, name)
+		if !ok {
+			return s
+		}
+		rt, _ := valueInterface(indirect(v)).(RichText)
+		text := d.formatValue(v)
+		if rt != nil {
+			text = rt.String()
+		}
+		value, err := encode(text)
+		if err != nil {
+			return s
+		}
+		search := valueToken(len(r.reps))
+		r.reps = append(r.reps, replacement{key: name, search: search, value: value, rich: rt})
+		r.placeholders = append(r.placeholders, s)
+		return search
+	})
+}
+
+// lookup 在作用域链中按路径查找值，内层作用域优先
+func lookup(scope []reflect.Value, path string) (reflect.Value, bool) {
+	if len(scope) == 0 {
+		return reflect.Value{}, false
+	}
+	if path == "." || path == "this" {
+		return scope[len(scope)-1], true
+	}
+	keys := strings.Split(path, ".")
+	for i := len(scope) - 1; i >= 0; i-- {
+		v, ok := field(scope[i], keys[0])
+		if !ok {
+			continue
+		}
+		for _, key := range keys[1:] {
+			if v, ok = field(v, key); !ok {
+				return reflect.Value{}, false
+			}
+		}
+		return v, true
+	}
+	return reflect.Value{}, false
+}
+
+// field 获取 map 的键、结构体的字段或切片的下标
+func field(v reflect.Value, name string) (reflect.Value, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		res := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		return res, res.IsValid()
+	case reflect.Struct:
+		return structField(v, name)
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= v.Len() {
+			return reflect.Value{}, false
+		}
+		return v.Index(i), true
+	}
+	return reflect.Value{}, false
+}
+
+// structField 按 docx 标签或字段名查找结构体字段，匿名嵌入的结构体会被展开
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	var embedded []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("docx"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" && f.Anonymous {
+			embedded = append(embedded, i)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag == name || (tag == "" && f.Name == name) {
+			return v.Field(i), true
+		}
+	}
+	for _, i := range embedded {
+		if res, ok := field(v.Field(i), name); ok {
+			return res, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// eachItems 循环块的元素，切片和数组逐个展开，其他真值作为单个元素
+func eachItems(v reflect.Value) []reflect.Value {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items := make([]reflect.Value, v.Len())
+		for i := range items {
+			items[i] = v.Index(i)
+		}
+		return items
+	}
+	if isTruthy(valueInterface(v)) {
+		return []reflect.Value{v}
+	}
+	return nil
+}
+
+// formatValue 将值格式化为文本
+func (d *Docx) formatValue(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if t, ok := valueInterface(v).(time.Time); ok {
+		layout := d.Config.TimeFormat
+		if layout == "" {
+			layout = defaultTimeFormat
+		}
+		return t.Format(layout)
+	}
+	if s, ok := valueInterface(v).(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return fmt.Sprint(valueInterface(v))
+}
+
+// indirect 解开指针与接口，nil 时返回无效值
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// valueInterface 获取值对应的 interface{}，无效或不可导出时返回 nil
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,92 @@
+package docx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	type address struct {
+		City string `docx:"city"`
+	}
+	type item struct {
+		Name  string  `docx:"name"`
+		Price float64 `docx:"price"`
+	}
+	type customer struct {
+		Name    string   `docx:"name"`
+		Address *address `docx:"address"`
+		Secret  string   `docx:"-"`
+	}
+	data := struct {
+		Customer customer `docx:"customer"`
+		Items    []item   `docx:"items"`
+		Paid     bool     `docx:"paid"`
+		Date     time.Time
+		Extra    map[string]interface{} `docx:"extra"`
+	}{
+		Customer: customer{Name: "A&B", Address: &address{City: "Paris"}, Secret: "x"},
+		Items:    []item{{"pen", 1.5}, {"book", 12}},
+		Date:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Extra:    map[string]interface{}{"count": 3, "tags": []string{"x", "y"}},
+	}
+
+	body := testParagraph(`{{customer.name}} / {{customer.address.city}} / {{customer.Secret}}`) +
+		testParagraph(`{{#each items}}{{name}}={{price}} ({{customer.name}}); {{/each}}`) +
+		testParagraph(`{{#if paid}}paid{{/if}}{{Date}} {{extra.count}} {{#each extra.tags}}{{.}}{{/each}}`) +
+		testParagraph(`{{missing}}`)
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.Render(&data); err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+
+	want := testParagraph(`A&amp;B / Paris / {{customer.Secret}}`) +
+		testParagraph(`pen=1.5 (A&amp;B); book=12 (A&amp;B); `) +
+		testParagraph(`2024-05-01 3 xy`) +
+		testParagraph(`{{missing}}`)
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("渲染结果错误: %s", doc.MainPart)
+	}
+
+	if err := doc.Render("text"); err == nil {
+		t.Error("非结构体或 map 的数据应返回错误")
+	}
+}
+
+func TestRenderBlocksInOneRow(t *testing.T) {
+	cell := func(body string) string { return `<w:tc>` + body + `</w:tc>` }
+	body := `<w:tbl><w:tr>` +
+		cell(testParagraph(`{{#if a}}x`)+testParagraph(`{{/if}}`)) +
+		cell(testParagraph(`{{#each items}}{{.}}`)+testParagraph(`{{/each}}`)) +
+		`</w:tr></w:tbl>`
+
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	if err := doc.Render(map[string]interface{}{"a": true, "items": []string{"1", "2"}}); err != nil {
+		t.Fatalf("同一行中的多个块应依次处理: %v", err)
+	}
+	empty := testParagraph(``)
+	row := `<w:tr>` + cell(testParagraph(`x`)+empty) + cell(testParagraph(`1`)+empty) + `</w:tr>` +
+		`<w:tr>` + cell(testParagraph(`x`)+empty) + cell(testParagraph(`2`)+empty) + `</w:tr>`
+	if !strings.Contains(doc.MainPart, `<w:tbl>`+row+`</w:tbl>`) {
+		t.Errorf("渲染结果错误: %s", doc.MainPart)
+	}
+}
+
+func TestRenderMultilineValue(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{note}}`)+`<w:p><w:fldSimple w:instr="{{note}}"/></w:p>`)
+	defer doc.Close()
+
+	if err := doc.Render(map[string]string{"note": "x\r\ny"}); err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+	want := `<w:t xml:space="preserve">x</w:t><w:br/><w:t xml:space="preserve">y</w:t>`
+	if !strings.Contains(doc.MainPart, want) || !strings.Contains(doc.MainPart, `w:instr="{{note}}"`) {
+		t.Errorf("换行应拆分为 w:br，属性值不应被替换: %s", doc.MainPart)
+	}
+}
@@ -0,0 +1,213 @@
+package docx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RichText 富文本，由多段带格式的文本组成
+/*
+	doc.SetValue("name", docx.RichText{
+		{Text: "Hello, "},
+		{Text: "World", Bold: true, Color: "FF0000"},
+	})
+
+每一段生成一个 run，未设置的格式沿用占位符所在 run 的 w:rPr
+*/
+type RichText []TextSegment
+
+// TextSegment 富文本中的一段，零值的格式沿用占位符所在 run 的格式
+type TextSegment struct {
+	Text        string  // 文本，换行符转换为 <w:br/>
+	Bold        bool    // 加粗
+	Italic      bool    // 斜体
+	Underline   bool    // 单下划线
+	Strike      bool    // 删除线
+	Color       string  // 文字颜色，如 FF0000
+	Highlight   string  // 突出显示颜色: yellow、green、cyan ...
+	Font        string  // 字体名，同时用于西文与东亚文字
+	Size        float64 // 字号 (磅)，如 10.5
+	Superscript bool    // 上标
+	Subscript   bool    // 下标
+}
+
+// String 返回不带格式的文本
+func (r RichText) String() string {
+	var sb strings.Builder
+	for _, seg := range r {
+		sb.WriteString(seg.Text)
+	}
+	return sb.String()
+}
+
+// rPrOrder CT_RPr 中子元素的顺序，Word 要求 w:rPr 的子元素按此顺序出现
+var rPrOrder = []string{
+	"w:rStyle", "w:rFonts", "w:b", "w:bCs", "w:i", "w:iCs", "w:caps", "w:smallCaps", "w:strike", "w:dstrike",
+	"w:outline", "w:shadow", "w:emboss", "w:imprint", "w:noProof", "w:snapToGrid", "w:vanish", "w:webHidden",
+	"w:color", "w:spacing", "w:w", "w:kern", "w:position", "w:sz", "w:szCs", "w:highlight", "w:u", "w:effect",
+	"w:bdr", "w:shd", "w:fitText", "w:vertAlign", "w:rtl", "w:cs", "w:em", "w:lang", "w:eastAsianLayout",
+	"w:specVanish", "w:oMath", "w:rPrChange",
+}
+
+// rPrRank 返回元素在 rPrOrder 中的位置，未知元素为 -1
+func rPrRank(name string) int {
+	for i, n := range rPrOrder {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// properties 返回该段设置的格式元素
+func (s TextSegment) properties() []*node {
+	var props []*node
+	add := func(name, attrs string) {
+		props = append(props, &node{typ: elementNode, name: name, open: "<" + name + attrs + "/>"})
+	}
+	if s.Font != "" {
+		font := escapeText(s.Font)
+		add("w:rFonts", ` w:ascii="`+font+`" w:hAnsi="`+font+`" w:eastAsia="`+font+`" w:cs="`+font+`"`)
+	}
+	if s.Bold {
+		add("w:b", "")
+		add("w:bCs", "")
+	}
+	if s.Italic {
+		add("w:i", "")
+		add("w:iCs", "")
+	}
+	if s.Strike {
+		add("w:strike", "")
+	}
+	if s.Color != "" {
+		add("w:color", ` w:val="`+escapeText(strings.TrimPrefix(s.Color, "#"))+`"`)
+	}
+	if s.Size > 0 {
+		halfPoints := ` w:val="` + strconv.Itoa(int(math.Round(s.Size*2))) + `"`
+		add("w:sz", halfPoints)
+		add("w:szCs", halfPoints)
+	}
+	if s.Highlight != "" {
+		add("w:highlight", ` w:val="`+escapeText(s.Highlight)+`"`)
+	}
+	if s.Underline {
+		add("w:u", ` w:val="single"`)
+	}
+	if s.Superscript {
+		add("w:vertAlign", ` w:val="superscript"`)
+	} else if s.Subscript {
+		add("w:vertAlign", ` w:val="subscript"`)
+	}
+	return props
+}
+
+// mergeRPr 在 base (可为 nil) 的副本上设置 props，同名元素被替换，新元素按 rPrOrder 插入
+// 结果为空时返回 nil
+func mergeRPr(base *node, props []*node) *node {
+	var rPr *node
+	if base != nil {
+		rPr = base.clone()
+	} else {
+		rPr = &node{typ: elementNode, name: "w:rPr", open: "<w:rPr>", close: "</w:rPr>"}
+	}
+	for _, p := range props {
+		pos, replaced := len(rPr.children), false
+		for i, c := range rPr.children {
+			if c.typ != elementNode {
+				continue
+			}
+			if c.name == p.name {
+				c.replaceWith(p)
+				replaced = true
+				break
+			}
+			if rank := rPrRank(c.name); rank > rPrRank(p.name) && pos == len(rPr.children) {
+				pos = i
+			}
+		}
+		if !replaced {
+			rPr.insert(pos, p)
+		}
+	}
+	if len(rPr.children) == 0 {
+		return nil
+	}
+	return rPr
+}
+
+// setRichText 将 w:t 中的 search 替换为富文本的 run，返回占位符前后文本所在的新文本节点
+// 文本不在 run 的 w:t 中时返回 false
+func setRichText(t *node, search string, rt RichText) ([]*node, bool) {
+	wt := t.parent
+	if wt == nil || wt.name != "w:t" || len(wt.children) != 1 || wt.parent == nil || wt.parent.name != "w:r" {
+		return nil, false
+	}
+	r := wt.parent
+	var rPr *node
+	for _, c := range r.children {
+		if c.typ == elementNode && c.name == "w:rPr" {
+			rPr = c
+			break
+		}
+	}
+	segments := make([]*node, 0, len(rt))
+	for _, seg := range rt {
+		if seg.Text == "" {
+			continue
+		}
+		nodes, err := parseFragment(textRun(seg.Text, ""))
+		if err != nil {
+			return nil, false
+		}
+		run := nodes[0]
+		if merged := mergeRPr(rPr, seg.properties()); merged != nil {
+			run.insert(0, merged)
+		}
+		segments = append(segments, run)
+	}
+
+	// 占位符前后的文本与其他子元素移入沿用原格式的 run 中
+	idx := wt.index()
+	children := r.children
+	pieces := strings.Split(t.text, search)
+	var runs, texts []*node
+	for i, piece := range pieces {
+		if i > 0 {
+			for _, seg := range segments {
+				runs = append(runs, seg.clone())
+			}
+		}
+		run := &node{typ: elementNode, name: r.name, open: r.open, close: r.close}
+		if rPr != nil {
+			run.append(rPr.clone())
+		}
+		if i == 0 {
+			for _, c := range children[:idx] {
+				if c != rPr {
+					run.append(c)
+				}
+			}
+		}
+		if piece != "" {
+			e := newTextElement(wt, piece)
+			preserveSpace(e)
+			run.append(e)
+			texts = append(texts, e.children...)
+		}
+		if i == len(pieces)-1 {
+			for _, c := range children[idx+1:] {
+				run.append(c)
+			}
+		}
+		for _, c := range run.children {
+			if c.typ == elementNode && c.name != "w:rPr" {
+				runs = append(runs, run)
+				break
+			}
+		}
+	}
+	r.replaceWith(runs...)
+	return texts, true
+}
@@ -0,0 +1,88 @@
+package docx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetRichText(t *testing.T) {
+	doc := newTestDocx(t, `<w:p><w:r><w:rPr><w:rFonts w:ascii="Arial"/><w:i/><w:sz w:val="20"/><w:lang w:val="en-US"/></w:rPr>`+
+		`<w:tab/><w:t>Dear {{name}}, hi</w:t></w:r></w:p><w:p><w:fldSimple w:instr="{{name}}"/></w:p>`)
+	defer doc.Close()
+
+	err := doc.SetValue("name", RichText{
+		{Text: "Mr. "},
+		{Text: "Smith", Bold: true, Color: "#FF0000", Size: 12, Underline: true},
+		{Text: ""},
+	})
+	if err != nil {
+		t.Fatalf("替换富文本失败: %v", err)
+	}
+
+	rPr := `<w:rPr><w:rFonts w:ascii="Arial"/><w:i/><w:sz w:val="20"/><w:lang w:val="en-US"/></w:rPr>`
+	want := `<w:p><w:r>` + rPr + `<w:tab/><w:t xml:space="preserve">Dear </w:t></w:r>` +
+		`<w:r>` + rPr + `<w:t xml:space="preserve">Mr. </w:t></w:r>` +
+		`<w:r><w:rPr><w:rFonts w:ascii="Arial"/><w:b/><w:bCs/><w:i/><w:color w:val="FF0000"/><w:sz w:val="24"/><w:szCs w:val="24"/><w:u w:val="single"/><w:lang w:val="en-US"/></w:rPr><w:t xml:space="preserve">Smith</w:t></w:r>` +
+		`<w:r>` + rPr + `<w:t xml:space="preserve">, hi</w:t></w:r></w:p>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("富文本 run 错误: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.MainPart, `<w:fldSimple w:instr="{{name}}"/>`) {
+		t.Errorf("属性值不应被替换: %s", doc.MainPart)
+	}
+}
+
+func TestSetRichTextWithoutFormatting(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{a}}`)+testParagraph(`{{a}} and {{a}}`))
+	defer doc.Close()
+
+	if err := doc.SetValue("a", RichText{{Text: "x\ny", Superscript: true}}); err != nil {
+		t.Fatalf("替换富文本失败: %v", err)
+	}
+	run := `<w:r><w:rPr><w:vertAlign w:val="superscript"/></w:rPr><w:t xml:space="preserve">x</w:t><w:br/><w:t xml:space="preserve">y</w:t></w:r>`
+	if !strings.Contains(doc.MainPart, `<w:p>`+run+`</w:p>`) {
+		t.Errorf("单独占位符应只剩富文本 run: %s", doc.MainPart)
+	}
+	if !strings.Contains(doc.MainPart, run+`<w:r><w:t xml:space="preserve"> and </w:t></w:r>`+run) {
+		t.Errorf("同一 w:t 中的多个占位符都应替换: %s", doc.MainPart)
+	}
+
+	if err := doc.SetValue("missing", RichText{{Text: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	var pe *PlaceholderError
+	if !errors.As(doc.Unresolved(), &pe) || len(pe.Extra) != 1 || pe.Extra[0] != "missing" {
+		t.Errorf("未匹配的键应被记录: %v", doc.Unresolved())
+	}
+}
+
+func TestSetValueMapWithRichText(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{a}} {{b}}`))
+	defer doc.Close()
+
+	if err := doc.SetValue(map[string]interface{}{"a": RichText{{Text: "x", Bold: true}}, "b": "<y>"}); err != nil {
+		t.Fatalf("替换失败: %v", err)
+	}
+	want := `<w:r><w:rPr><w:b/><w:bCs/></w:rPr><w:t xml:space="preserve">x</w:t></w:r><w:r><w:t xml:space="preserve"> &lt;y&gt;</w:t></w:r>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("map 中的富文本与文本替换错误: %s", doc.MainPart)
+	}
+	if err := doc.SetValue(map[string]interface{}{"a": 1}); err == nil {
+		t.Error("值类型不支持时应返回错误")
+	}
+}
+
+func TestRenderRichText(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`Hi {{name}}`)+`<w:p><w:fldSimple w:instr="{{name}}"/></w:p>`)
+	defer doc.Close()
+
+	data := map[string]interface{}{"name": RichText{{Text: "Bob", Italic: true}}}
+	if err := doc.Render(data); err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+	want := `<w:r><w:t xml:space="preserve">Hi </w:t></w:r><w:r><w:rPr><w:i/><w:iCs/></w:rPr><w:t xml:space="preserve">Bob</w:t></w:r>`
+	if !strings.Contains(doc.MainPart, want) || !strings.Contains(doc.MainPart, `w:instr="{{name}}"`) {
+		t.Errorf("Render 中的富文本替换错误: %s", doc.MainPart)
+	}
+}
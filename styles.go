@@ -0,0 +1,169 @@
+package docx
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	nsWordprocessingML   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	numberingRelType     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering"
+	hyperlinkRelType     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	numberingContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"
+)
+
+var (
+	abstractNumIDReg = regexp.MustCompile(`\sw:abstractNumId="(\d+)"`)
+	numIDReg         = regexp.MustCompile(`\sw:numId="(\d+)"`)
+)
+
+// styleDef 模板中缺少内置样式时添加的定义
+type styleDef struct {
+	typ string // paragraph 或 character
+	id  string
+	pPr string
+	rPr string
+}
+
+// builtinStyles 按 Word 内置样式名称索引的默认定义
+var builtinStyles = map[string]styleDef{
+	"Quote":             {"paragraph", "Quote", `<w:ind w:left="720" w:right="720"/>`, `<w:i/><w:iCs/><w:color w:val="595959"/>`},
+	"HTML Preformatted": {"paragraph", "HTMLPreformatted", `<w:spacing w:after="0"/>`, `<w:rFonts w:ascii="Courier New" w:hAnsi="Courier New" w:cs="Courier New"/><w:sz w:val="20"/><w:szCs w:val="20"/>`},
+	"HTML Code":         {"character", "HTMLCode", "", `<w:rFonts w:ascii="Courier New" w:hAnsi="Courier New" w:cs="Courier New"/><w:sz w:val="20"/><w:szCs w:val="20"/>`},
+	"caption":           {"paragraph", "Caption", `<w:spacing w:after="200"/>`, `<w:i/><w:iCs/><w:color w:val="44546A"/><w:sz w:val="18"/><w:szCs w:val="18"/>`},
+}
+
+func init() {
+	// 标题 1-6 的字号 (半磅)
+	sizes := []int{32, 28, 26, 24, 22, 22}
+	for i, size := range sizes {
+		n := strconv.Itoa(i + 1)
+		sz := strconv.Itoa(size)
+		builtinStyles["heading "+n] = styleDef{
+			"paragraph", "Heading" + n,
+			`<w:keepNext/><w:keepLines/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="` + strconv.Itoa(i) + `"/>`,
+			`<w:b/><w:bCs/><w:sz w:val="` + sz + `"/><w:szCs w:val="` + sz + `"/>`,
+		}
+	}
+}
+
+// xml 生成样式定义
+func (s styleDef) xml(name string) string {
+	var sb strings.Builder
+	sb.WriteString(`<w:style w:type="` + s.typ + `" w:styleId="` + s.id + `"><w:name w:val="` + escapeText(name) + `"/><w:qFormat/>`)
+	if s.pPr != "" {
+		sb.WriteString(`<w:pPr>` + s.pPr + `</w:pPr>`)
+	}
+	if s.rPr != "" {
+		sb.WriteString(`<w:rPr>` + s.rPr + `</w:rPr>`)
+	}
+	sb.WriteString(`</w:style>`)
+	return sb.String()
+}
+
+// styleID 返回名称为 name (不区分大小写) 的样式 id
+// 模板中有同名样式时使用其 id (如中文模板中标题 1 的 id 为 1)，否则添加 builtinStyles 中的定义
+func (d *Docx) styleID(name string) string {
+	def, ok := builtinStyles[name]
+	if !ok {
+		return name
+	}
+	styles := d.part(getStylesName())
+	root, err := parseXML(styles)
+	if err != nil || styles == "" {
+		return def.id
+	}
+	for _, s := range root.elements("w:style") {
+		for _, n := range s.elements("w:name") {
+			if strings.EqualFold(n.attr("w:val"), name) {
+				return s.attr("w:styleId")
+			}
+		}
+		if s.attr("w:styleId") == def.id {
+			return def.id
+		}
+	}
+	if list := root.elements("w:styles"); len(list) > 0 {
+		if nodes, err := parseFragment(def.xml(name)); err == nil {
+			list[0].append(nodes...)
+			d.setPart(getStylesName(), root.String())
+		}
+	}
+	return def.id
+}
+
+// addNumbering 新建一个列表编号定义并返回其 w:numId，ordered 为 false 时为项目符号
+// start 为有序列表的起始编号，numbering.xml 不存在时新建并登记关系与内容类型
+func (d *Docx) addNumbering(ordered bool, start int) int {
+	content := d.part(getNumberingName())
+	if content == "" {
+		content = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<w:numbering xmlns:w="` + nsWordprocessingML + `"></w:numbering>`
+		d.addRelationship(d.MainPartName, numberingRelType, relativeTarget(d.MainPartName, getNumberingName()), false)
+		override := `<Override PartName="/` + getNumberingName() + `" ContentType="` + numberingContentType + `"/>`
+		d.ContentTypes = strings.Replace(d.ContentTypes, `</Types>`, override+`</Types>`, 1)
+	}
+	abstractID, numID := maxSubmatch(abstractNumIDReg, content)+1, maxSubmatch(numIDReg, content)+1
+
+	root, err := parseXML(content)
+	if err != nil {
+		return 0
+	}
+	list := root.elements("w:numbering")
+	if len(list) == 0 {
+		return 0
+	}
+	numbering := list[0]
+	abstractNum, _ := parseFragment(abstractNumXML(abstractID, ordered))
+	num := `<w:num w:numId="` + strconv.Itoa(numID) + `"><w:abstractNumId w:val="` + strconv.Itoa(abstractID) + `"/>`
+	if ordered && start > 1 {
+		num += `<w:lvlOverride w:ilvl="0"><w:startOverride w:val="` + strconv.Itoa(start) + `"/></w:lvlOverride>`
+	}
+	numNodes, _ := parseFragment(num + `</w:num>`)
+
+	// 所有 w:abstractNum 必须位于 w:num 之前，w:numIdMacAtCleanup 在最后
+	abstractPos, numPos := len(numbering.children), len(numbering.children)
+	for i := len(numbering.children) - 1; i >= 0; i-- {
+		switch numbering.children[i].name {
+		case "w:num":
+			abstractPos = i
+		case "w:numIdMacAtCleanup":
+			abstractPos, numPos = i, i
+		}
+	}
+	numbering.insert(numPos, numNodes...)
+	numbering.insert(abstractPos, abstractNum...)
+	d.setPart(getNumberingName(), root.String())
+	return numID
+}
+
+// abstractNumXML 生成 9 级的列表编号定义
+func abstractNumXML(id int, ordered bool) string {
+	bullets := []string{"•", "◦", "▪"}
+	formats := []string{"decimal", "lowerLetter", "lowerRoman"}
+	var sb strings.Builder
+	sb.WriteString(`<w:abstractNum w:abstractNumId="` + strconv.Itoa(id) + `"><w:multiLevelType w:val="hybridMultilevel"/>`)
+	for lvl := 0; lvl < 9; lvl++ {
+		numFmt, text := "bullet", bullets[lvl%3]
+		if ordered {
+			numFmt, text = formats[lvl%3], "%"+strconv.Itoa(lvl+1)+"."
+		}
+		sb.WriteString(`<w:lvl w:ilvl="` + strconv.Itoa(lvl) + `"><w:start w:val="1"/><w:numFmt w:val="` + numFmt + `"/>` +
+			`<w:lvlText w:val="` + text + `"/><w:lvlJc w:val="left"/>` +
+			`<w:pPr><w:ind w:left="` + strconv.Itoa(listIndent*(lvl+1)) + `" w:hanging="360"/></w:pPr></w:lvl>`)
+	}
+	sb.WriteString(`</w:abstractNum>`)
+	return sb.String()
+}
+
+// maxSubmatch 返回 reg 第一个分组中数字的最大值，没有匹配时为 0
+func maxSubmatch(reg *regexp.Regexp, s string) int {
+	res := 0
+	for _, m := range reg.FindAllStringSubmatch(s, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > res {
+			res = n
+		}
+	}
+	return res
+}
@@ -1,79 +1,330 @@
 package docx
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-func findRowStart(d *Docx, offset int) (rowStart int) {
-	temp := []byte(d.MainPart)[:offset]
-	rowStart = strings.LastIndex(string(temp), `<w:tr `)
-	if rowStart == -1 {
-		rowStart = strings.LastIndex(string(temp), `<w:tr>`)
+// 设置标记
+func ensureMacroCompleted(d *Docx, mark string) string {
+	if strings.HasPrefix(mark, d.Config.PlaceholderPrefix) && strings.HasSuffix(mark, d.Config.PlaceholderSuffix) {
+		return mark
 	}
-	return
+	return d.Config.PlaceholderPrefix + mark + d.Config.PlaceholderSuffix
 }
 
-func findRowEnd(d *Docx, offset int) (rowEnd int) {
+// indexVariables 为内容中的占位符加上索引 #i，块的结束标记 (如 {{/if}}) 保持不变
+func indexVariables(d *Docx, xml string, i int) string {
+	return fillIndexedVariables(d, xml, i, nil)
+}
 
-	rowEnd = strings.Index(string([]byte(d.MainPart)[offset:]), `</w:tr>`)
+// fillIndexedVariables 按整个占位符匹配，value 提供替换内容的占位符替换为该内容 (不再转义)，其余加上索引 #i
+func fillIndexedVariables(d *Docx, xml string, i int, value func(name string) (string, bool)) string {
+	// 转义前缀和后缀用于正则
+	prefix := regexp.QuoteMeta(d.Config.PlaceholderPrefix)
+	suffix := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
+	reg := regexp.MustCompile(prefix + `(.*?)` + suffix)
+
+	return reg.ReplaceAllStringFunc(xml, func(s string) string {
+		name := reg.FindStringSubmatch(s)[1]
+		if strings.HasPrefix(name, "/") {
+			return s
+		}
+		if value != nil {
+			if v, ok := value(name); ok {
+				return v
+			}
+		}
+		// 恢复为原始格式并加上索引
+		return d.Config.PlaceholderPrefix + name + "#" + strconv.Itoa(i) + d.Config.PlaceholderSuffix
+	})
+}
+
+// ErrNotInTableRow 占位符不在表格行中
+var ErrNotInTableRow = errors.New("docx: placeholder is not inside a table row")
+
+/*
+CloneRow 复制行 (标记 行数)
+
+在主体、页眉和页脚中查找所有包含标记的表格行，每一行复制 n 次，
+副本中的占位符加上索引 #0 ... #n-1，n 为 0 时删除该行，表格因此不再有任何行时删除整个表格。
+标记不存在时返回 ErrPlaceholderNotFound，不在任何表格行中时返回 ErrNotInTableRow。
+*/
+func (d *Docx) CloneRow(mark string, n int) error {
+	return d.cloneRowsInParts(mark, n, func(i int, text string) string {
+		return indexVariables(d, text, i)
+	})
+}
 
-	return rowEnd + offset + 7
+// cloneRowsInParts 在所有部件中将包含 mark 的表格行复制 n 次，第 i 个副本中每个文本节点的内容替换为 fill(i, 原内容)
+func (d *Docx) cloneRowsInParts(mark string, n int, fill func(i int, text string) string) error {
+	mark = ensureMacroCompleted(d, mark)
+	found, rows := false, 0
+	err := d.updateTrees(func(_ string, root *node) (bool, error) {
+		texts := root.texts(mark)
+		if len(texts) > 0 {
+			found = true
+		}
+		count := cloneRows(root, texts, n, fill)
+		rows += count
+		return count > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, mark)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrNotInTableRow, mark)
+	}
+	return nil
 }
 
-func getRow(d *Docx, startPosition, endPosition int) (content string) {
-	if endPosition == -1 {
-		endPosition = len(d.MainPart)
+// cloneRows 将 texts 所在的每个表格行 (嵌套表格时为最内层的行) 替换为 n 个副本，副本的文本由 fill 填充
+// 返回处理的行数，不在表格行中的文本会被跳过
+func cloneRows(root *node, texts []*node, n int, fill func(i int, text string) string) int {
+	count := 0
+	done := make(map[*node]bool)
+	for _, t := range texts {
+		row := t.ancestor("w:tr")
+		if row == nil || done[row] || !row.attached(root) {
+			continue
+		}
+		done[row] = true
+		rows := make([]*node, n)
+		for i := range rows {
+			rows[i] = row.clone()
+			for _, c := range rows[i].findAll(func(c *node) bool { return c.typ == textNode }) {
+				if s := fill(i, c.text); s != c.text {
+					setRawText(c, s)
+				}
+			}
+		}
+		tbl := row.ancestor("w:tbl")
+		row.replaceWith(rows...)
+		if n == 0 {
+			removeEmptyTableNode(tbl)
+		}
+		count++
 	}
-	contentTemp := []byte(d.MainPart)
-	content = string(contentTemp[startPosition:endPosition])
-	return
+	return count
 }
 
-// 设置标记
-func ensureMacroCompleted(d *Docx, mark string) string {
-	if strings.HasPrefix(mark, d.Config.PlaceholderPrefix) && strings.HasSuffix(mark, d.Config.PlaceholderSuffix) {
-		return mark
+/*
+SetTableRows 按 rows 复制 mark 所在的模板行 (规则同 CloneRow)，并用每个 map 填充对应的行
+
+	doc.SetTableRows("name", []map[string]string{
+		{"name": "Alice", "age": "20"},
+		{"name": "Bob", "age": "21"},
+	})
+
+行中未出现在 map 中的占位符保持不变，rows 为空时删除模板行
+*/
+func (d *Docx) SetTableRows(mark string, rows []map[string]string) error {
+	return d.setTableRows(mark, len(rows), func(i int, name string) (string, bool) {
+		v, ok := rows[i][name]
+		return v, ok
+	})
+}
+
+// SetTableRowsFrom 与 SetTableRows 相同，rows 为结构体或 map 的切片，取值规则同 Render
+func (d *Docx) SetTableRowsFrom(mark string, rows interface{}) error {
+	v := indirect(reflect.ValueOf(rows))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return errors.New("docx: SetTableRowsFrom expects a slice")
 	}
-	return d.Config.PlaceholderPrefix + mark + d.Config.PlaceholderSuffix
+	return d.setTableRows(mark, v.Len(), func(i int, name string) (string, bool) {
+		value, ok := lookup([]reflect.Value{v.Index(i)}, name)
+		if !ok {
+			return "", false
+		}
+		return d.formatValue(value), true
+	})
 }
 
-func indexClonedVariables(d *Docx, xmlRow, mark string, n int) string {
-	var bt bytes.Buffer
-	// 转义前缀和后缀用于正则
+// setTableRows 复制模板行 n 次，第 i 行中的占位符由 value(i, name) 提供
+func (d *Docx) setTableRows(mark string, n int, value func(i int, name string) (string, bool)) error {
+	return d.cloneRowsInParts(mark, n, func(i int, text string) string {
+		return fillVariables(d, text, func(name string) (string, bool) {
+			return value(i, name)
+		})
+	})
+}
+
+// fillVariables 用 value 提供的值填充内容中的占位符，未提供值的占位符保持不变
+func fillVariables(d *Docx, xml string, value func(name string) (string, bool)) string {
 	prefix := regexp.QuoteMeta(d.Config.PlaceholderPrefix)
 	suffix := regexp.QuoteMeta(d.Config.PlaceholderSuffix)
 	reg := regexp.MustCompile(prefix + `(.*?)` + suffix)
 
-	for i := 0; i < n; i++ {
-		// 恢复为原始格式并加上索引
-		bt.WriteString(reg.ReplaceAllString(xmlRow, d.Config.PlaceholderPrefix+"$1#"+strconv.Itoa(i)+d.Config.PlaceholderSuffix))
+	return reg.ReplaceAllStringFunc(xml, func(s string) string {
+		v, ok := value(reg.FindStringSubmatch(s)[1])
+		if !ok {
+			return s
+		}
+		encoded, err := encode(v)
+		if err != nil {
+			return s
+		}
+		return encoded
+	})
+}
+
+// defaultTableWidth 未指定列宽时新建表格的总宽度 (twip)
+const defaultTableWidth = 9000
+
+// Table 新建表格的内容与样式
+type Table struct {
+	Header        []string     // 表头行，为空时不生成
+	Rows          [][]string   // 数据行，列数不足的行以空单元格补齐
+	ColumnWidths  []int        // 列宽 (twip，1/1440 英寸)，未指定的列平均分配 defaultTableWidth
+	StyleID       string       // styles.xml 中的表格样式 id，如 TableGrid
+	Border        *TableBorder // 边框，为 nil 时由样式决定
+	HeaderShading string       // 表头底色，如 D9D9D9
+	Shading       [][]string   // 数据单元格底色，与 Rows 一一对应，为空的单元格不设置
+}
+
+// TableBorder 表格边框
+type TableBorder struct {
+	Style string // 线型: single、double、dashed、dotted ...，默认 single
+	Size  int    // 线宽，单位 1/8 磅，默认 4
+	Color string // 颜色，如 000000，默认 auto
+}
+
+/*
+SetTable 在标记处新建表格
+
+	模板: {{table:report}}
+	doc.SetTable("table:report", docx.Table{
+		Header: []string{"Name", "Score"},
+		Rows:   [][]string{{"Alice", "90"}, {"Bob", "85"}},
+	})
+
+标记所在的整个段落会被替换为表格，段落中的其他文本一并删除
+*/
+func (d *Docx) SetTable(mark string, table Table) error {
+	if table.StyleID != "" {
+		styles := d.part(getStylesName())
+		if !strings.Contains(styles, `w:styleId="`+table.StyleID+`"`) {
+			return fmt.Errorf("docx: table style %q not found in styles.xml", table.StyleID)
+		}
 	}
-	return bt.String()
+	return d.replaceElements(mark, "w:p", tableXML(table), ErrNotInParagraph)
 }
 
-// CloneRow 复制行 (标记 行数)
-func (d *Docx) CloneRow(mark string, n int) {
-	var tempxml []string
-	var bt bytes.Buffer
-	// //设置标记
-	mark = ensureMacroCompleted(d, mark)
-	//查询第一次出现的地方
-	tagPos := strings.Index(d.MainPart, mark)
-
-	//查找标记点开始行标签
-	rowStart := findRowStart(d, tagPos)
-	//查找标记点结束行标签
-	rowEnd := findRowEnd(d, tagPos)
-
-	xmlRow := getRow(d, rowStart, rowEnd)
-	tempxml = append(tempxml, getRow(d, 0, rowStart))
-	tempxml = append(tempxml, indexClonedVariables(d, xmlRow, mark, n))
-	tempxml = append(tempxml, getRow(d, rowEnd, len(d.MainPart)))
-	for _, v := range tempxml {
-		bt.WriteString(v)
-	}
-	d.MainPart = bt.String()
+// tableXML 生成表格的 XML
+func tableXML(t Table) string {
+	cols := len(t.Header)
+	for _, row := range t.Rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	if cols == 0 {
+		cols = 1
+	}
+	widths := make([]int, cols)
+	total := 0
+	for i := range widths {
+		if i < len(t.ColumnWidths) && t.ColumnWidths[i] > 0 {
+			widths[i] = t.ColumnWidths[i]
+		} else {
+			widths[i] = defaultTableWidth / cols
+		}
+		total += widths[i]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<w:tbl><w:tblPr>`)
+	if t.StyleID != "" {
+		sb.WriteString(`<w:tblStyle w:val="` + escapeText(t.StyleID) + `"/>`)
+	}
+	sb.WriteString(`<w:tblW w:w="` + strconv.Itoa(total) + `" w:type="dxa"/>`)
+	if t.Border != nil {
+		sb.WriteString(t.Border.xml())
+	}
+	sb.WriteString(`<w:tblLayout w:type="fixed"/>`)
+	firstRow := "0"
+	if len(t.Header) > 0 {
+		firstRow = "1"
+	}
+	sb.WriteString(`<w:tblLook w:val="04A0" w:firstRow="` + firstRow + `" w:lastRow="0" w:firstColumn="1" w:lastColumn="0" w:noHBand="0" w:noVBand="1"/>`)
+	sb.WriteString(`</w:tblPr><w:tblGrid>`)
+	for _, w := range widths {
+		sb.WriteString(`<w:gridCol w:w="` + strconv.Itoa(w) + `"/>`)
+	}
+	sb.WriteString(`</w:tblGrid>`)
+
+	if len(t.Header) > 0 {
+		sb.WriteString(`<w:tr><w:trPr><w:tblHeader/></w:trPr>`)
+		for i, w := range widths {
+			sb.WriteString(cellXML(cellText(t.Header, i), w, t.HeaderShading, `<w:b/>`))
+		}
+		sb.WriteString(`</w:tr>`)
+	}
+	for r, row := range t.Rows {
+		sb.WriteString(`<w:tr>`)
+		for i, w := range widths {
+			shading := ""
+			if r < len(t.Shading) {
+				shading = cellText(t.Shading[r], i)
+			}
+			sb.WriteString(cellXML(cellText(row, i), w, shading, ""))
+		}
+		sb.WriteString(`</w:tr>`)
+	}
+	sb.WriteString(`</w:tbl>`)
+	return sb.String()
+}
+
+// xml 生成 tblBorders
+func (b *TableBorder) xml() string {
+	style, size, color := b.Style, b.Size, b.Color
+	if style == "" {
+		style = "single"
+	}
+	if size <= 0 {
+		size = 4
+	}
+	if color == "" {
+		color = "auto"
+	}
+	attrs := ` w:val="` + escapeText(style) + `" w:sz="` + strconv.Itoa(size) + `" w:space="0" w:color="` + escapeText(color) + `"/>`
+	var sb strings.Builder
+	sb.WriteString(`<w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		sb.WriteString(`<w:` + side + attrs)
+	}
+	sb.WriteString(`</w:tblBorders>`)
+	return sb.String()
+}
+
+// cellXML 生成单元格的 XML
+func cellXML(text string, width int, shading, rPr string) string {
+	var sb strings.Builder
+	sb.WriteString(`<w:tc><w:tcPr><w:tcW w:w="` + strconv.Itoa(width) + `" w:type="dxa"/>`)
+	if shading != "" {
+		sb.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="` + escapeText(shading) + `"/>`)
+	}
+	sb.WriteString(`</w:tcPr>`)
+	if text == "" {
+		sb.WriteString(`<w:p/>`)
+	} else {
+		sb.WriteString(`<w:p>` + textRun(text, rPr) + `</w:p>`)
+	}
+	sb.WriteString(`</w:tc>`)
+	return sb.String()
+}
+
+// cellText 取切片中的第 i 个元素，越界时为空
+func cellText(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
 }
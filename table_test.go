@@ -0,0 +1,154 @@
+package docx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testRow 构造每个单元格只包含一段文本的表格行
+func testRow(cells ...string) string {
+	var sb strings.Builder
+	sb.WriteString(`<w:tr>`)
+	for _, c := range cells {
+		sb.WriteString(`<w:tc>` + testParagraph(c) + `</w:tc>`)
+	}
+	sb.WriteString(`</w:tr>`)
+	return sb.String()
+}
+
+func TestSetTableRows(t *testing.T) {
+	doc := newTestDocx(t, `<w:tbl>`+testRow(`Name`, `Age`)+testRow(`{{name}}`, `{{age}}`)+`</w:tbl>`)
+	defer doc.Close()
+
+	err := doc.SetTableRows("name", []map[string]string{
+		{"name": "Alice", "age": "20"},
+		{"name": "<Bob>"},
+	})
+	if err != nil {
+		t.Fatalf("填充表格失败: %v", err)
+	}
+	want := `<w:tbl>` + testRow(`Name`, `Age`) + testRow(`Alice`, `20`) + testRow(`&lt;Bob&gt;`, `{{age}}`) + `</w:tbl>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("填充表格结果错误: %s", doc.MainPart)
+	}
+
+	if err = doc.SetTableRows("name", nil); !errors.Is(err, ErrPlaceholderNotFound) {
+		t.Errorf("占位符不存在时应返回 ErrPlaceholderNotFound: %v", err)
+	}
+}
+
+func TestSetTableRowsOnTree(t *testing.T) {
+	doc := newTestDocx(t, `<w:tbl><w:tr><w:tc><w:tcPr><w:tcW w:w="{{w}}"/></w:tcPr>`+testParagraph(`{{name}}`)+`</w:tc></w:tr></w:tbl>`)
+	defer doc.Close()
+
+	if err := doc.SetTableRows("name", []map[string]string{{"name": "a\r\nb", "w": "1"}}); err != nil {
+		t.Fatalf("填充表格失败: %v", err)
+	}
+	want := `<w:tcW w:w="{{w}}"/></w:tcPr><w:p><w:r><w:t xml:space="preserve">a</w:t><w:br/><w:t xml:space="preserve">b</w:t></w:r></w:p>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("行中的换行应拆分为 w:br，属性值不应被替换: %s", doc.MainPart)
+	}
+}
+
+func TestSetTableRowsFrom(t *testing.T) {
+	type person struct {
+		Name string `docx:"name"`
+		Age  int    `docx:"age"`
+	}
+	doc := newTestDocx(t, testParagraph(`{{title}}`)+`<w:tbl>`+testRow(`{{name}}`, `{{age}}`)+`</w:tbl>`)
+	defer doc.Close()
+
+	if err := doc.SetTableRowsFrom("title", []person{}); !errors.Is(err, ErrNotInTableRow) {
+		t.Errorf("占位符不在表格行中时应返回 ErrNotInTableRow: %v", err)
+	}
+	if err := doc.SetTableRowsFrom("age", []person{{"Alice", 20}, {"Bob", 21}}); err != nil {
+		t.Fatalf("填充表格失败: %v", err)
+	}
+	want := `<w:tbl>` + testRow(`Alice`, `20`) + testRow(`Bob`, `21`) + `</w:tbl>`
+	if !strings.Contains(doc.MainPart, want) {
+		t.Errorf("填充表格结果错误: %s", doc.MainPart)
+	}
+
+	if err := doc.SetTableRowsFrom("name", nil); err == nil {
+		t.Error("非切片参数应返回错误")
+	}
+}
+
+func TestCloneRowInPartsAndTables(t *testing.T) {
+	table := `<w:tbl>` + testRow(`{{id}}`) + `</w:tbl>`
+	doc := newTestDocxWithParts(t, map[string]string{
+		"word/document.xml": fmt.Sprintf(testDocumentTpl, table+testParagraph(`{{title}}`)+table),
+		"word/header1.xml":  `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` + table + `</w:hdr>`,
+	})
+	defer doc.Close()
+
+	if err := doc.CloneRow("id", 2); err != nil {
+		t.Fatalf("复制行失败: %v", err)
+	}
+	cloned := `<w:tbl>` + testRow(`{{id#0}}`) + testRow(`{{id#1}}`) + `</w:tbl>`
+	if strings.Count(doc.MainPart, cloned) != 2 || !strings.Contains(doc.Headers[1], cloned) {
+		t.Errorf("应复制所有部件中所有表格的行: %s %s", doc.MainPart, doc.Headers[1])
+	}
+
+	if err := doc.CloneRow("title", 2); !errors.Is(err, ErrNotInTableRow) {
+		t.Errorf("占位符不在表格行中时应返回 ErrNotInTableRow: %v", err)
+	}
+	if err := doc.CloneRow("none", 2); !errors.Is(err, ErrPlaceholderNotFound) {
+		t.Errorf("占位符不存在时应返回 ErrPlaceholderNotFound: %v", err)
+	}
+}
+
+func TestCloneRowZeroRemovesEmptyTable(t *testing.T) {
+	nested := `<w:tbl>` + testRow(`{{inner}}`) + `</w:tbl>`
+	body := `<w:tbl>` + testRow(`{{only}}`) + `</w:tbl>` + testParagraph(`end`) +
+		`<w:tbl><w:tr><w:tc>` + testParagraph(`x`) + nested + `<w:p/></w:tc></w:tr></w:tbl>`
+	doc := newTestDocx(t, body)
+	defer doc.Close()
+
+	for _, mark := range []string{"only", "inner"} {
+		if err := doc.CloneRow(mark, 0); err != nil {
+			t.Fatalf("删除行失败: %v", err)
+		}
+	}
+	want := testParagraph(`end`) + `<w:tbl><w:tr><w:tc>` + testParagraph(`x`) + `<w:p/></w:tc></w:tr></w:tbl>`
+	if !strings.Contains(doc.MainPart, `<w:body>`+want+`</w:body>`) {
+		t.Errorf("没有行的表格应被删除: %s", doc.MainPart)
+	}
+}
+
+func TestSetTable(t *testing.T) {
+	doc := newTestDocx(t, testParagraph(`{{table:report}}`)+`<w:tbl><w:tr><w:tc>`+testParagraph(`{{table:report}}`)+`</w:tc></w:tr></w:tbl>`)
+	defer doc.Close()
+
+	table := Table{
+		Header:       []string{"Name", "Score"},
+		Rows:         [][]string{{"A&B", "90"}, {"C"}},
+		ColumnWidths: []int{3000},
+		Border:       &TableBorder{Color: "FF0000"},
+		Shading:      [][]string{nil, {"EEEEEE"}},
+	}
+	if err := doc.SetTable("table:report", Table{StyleID: "Missing"}); err == nil {
+		t.Error("样式不存在时应返回错误")
+	}
+	if err := doc.SetTable("table:report", table); err != nil {
+		t.Fatalf("新建表格失败: %v", err)
+	}
+
+	for _, want := range []string{
+		`<w:gridCol w:w="3000"/><w:gridCol w:w="4500"/>`,
+		`<w:top w:val="single" w:sz="4" w:space="0" w:color="FF0000"/>`,
+		`<w:tr><w:trPr><w:tblHeader/></w:trPr>`,
+		`<w:t xml:space="preserve">A&amp;B</w:t>`,
+		`<w:shd w:val="clear" w:color="auto" w:fill="EEEEEE"/></w:tcPr><w:p><w:r><w:t xml:space="preserve">C</w:t>`,
+		`<w:tcW w:w="4500" w:type="dxa"/></w:tcPr><w:p/></w:tc></w:tr></w:tbl><w:p/></w:tc>`,
+	} {
+		if !strings.Contains(doc.MainPart, want) {
+			t.Errorf("表格中缺少 %s: %s", want, doc.MainPart)
+		}
+	}
+	if strings.Contains(doc.MainPart, `{{table:report}}`) {
+		t.Error("标记应被替换")
+	}
+}
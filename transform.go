@@ -0,0 +1,318 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+// ImageTransform 插入前对图片的处理，均为纯 Go 实现
+type ImageTransform struct {
+	MaxWidth   int  // 像素宽度上限，超出时等比缩小
+	MaxHeight  int  // 像素高度上限，超出时等比缩小
+	DPI        int  // 按显示尺寸 (Width、Height，96 DPI) 计算像素上限，如 150 DPI 时 96 像素宽最多保留 150 像素
+	Quality    int  // JPEG 编码质量 1-100，不为 0 时 JPEG 总是重新编码，为 0 时使用 jpeg.DefaultQuality
+	AutoOrient bool // 按 EXIF 方向摆正 JPEG 照片
+	Rotate     int  // 额外顺时针旋转的角度，必须为 90 的倍数
+}
+
+// Transform 按 opts 处理图片并返回使用内存数据的新图片，BMP 总是转为 PNG
+// 只缩小不放大；显示尺寸 (Width、Height) 保持不变，旋转 90、270 度时交换宽高
+// 没有需要处理的内容时原样返回
+func (i ImgValue) Transform(opts ImageTransform) (ImgValue, error) {
+	if opts.Rotate%90 != 0 {
+		return i, fmt.Errorf("docx: rotate must be a multiple of 90: %d", opts.Rotate)
+	}
+	data, err := i.content()
+	if err != nil {
+		return i, err
+	}
+	t := sniffImageType(data)
+	if t == "" || t == "svg" {
+		return i, ErrUnsupportedImage
+	}
+	w, h, err := imageSize(data, t)
+	if err != nil {
+		return i, err
+	}
+
+	orientation := 1
+	if opts.AutoOrient && t == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+	rotation := map[int]int{90: 6, 180: 3, 270: 8}[(opts.Rotate%360+360)%360]
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	if rotation == 6 || rotation == 8 {
+		w, h = h, w
+	}
+
+	// 显示尺寸与像素尺寸一起摆正
+	dw, dh := i.Width, i.Height
+	if dw <= 0 || dh <= 0 {
+		dw, dh = w, h
+	} else if (orientation >= 5) != (rotation == 6 || rotation == 8) {
+		dw, dh = dh, dw
+	}
+
+	maxW, maxH := opts.MaxWidth, opts.MaxHeight
+	if opts.DPI > 0 {
+		if limit := dw * opts.DPI / 96; maxW <= 0 || limit < maxW {
+			maxW = limit
+		}
+		if limit := dh * opts.DPI / 96; maxH <= 0 || limit < maxH {
+			maxH = limit
+		}
+	}
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		scale = math.Min(scale, float64(maxH)/float64(h))
+	}
+	tw, th := w, h
+	if scale < 1 {
+		tw = int(math.Max(1, math.Round(float64(w)*scale)))
+		th = int(math.Max(1, math.Round(float64(h)*scale)))
+	}
+
+	if t != "bmp" && orientation <= 1 && rotation == 0 && tw == w && th == h && !(t == "jpeg" && opts.Quality > 0) {
+		return i, nil
+	}
+
+	var src image.Image
+	if t == "bmp" {
+		src, err = decodeBMP(data)
+	} else {
+		src, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return i, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	rgba := orientRGBA(orientRGBA(toRGBA(src), orientation), rotation)
+	if tw != rgba.Bounds().Dx() || th != rgba.Bounds().Dy() {
+		rgba = resizeRGBA(rgba, tw, th)
+	}
+
+	var buf bytes.Buffer
+	if t == "jpeg" {
+		quality := opts.Quality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: quality})
+	} else {
+		t = "png"
+		err = png.Encode(&buf, rgba)
+	}
+	if err != nil {
+		return i, err
+	}
+
+	i.Type, i.Width, i.Height, i.data = t, dw, dh, buf.Bytes()
+	return i, nil
+}
+
+// toRGBA 将图片转换为从 (0, 0) 开始的 *image.RGBA
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// orientRGBA 按 EXIF 方向值 (2-8) 翻转或旋转图片，1 或其他值时原样返回
+func orientRGBA(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := sw, sh
+	if orientation >= 5 {
+		dw, dh = sh, sw
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = sw-1-x, y
+			case 3: // 旋转 180 度
+				dx, dy = sw-1-x, sh-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, sh-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90 度
+				dx, dy = sh-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = sh-1-y, sw-1-x
+			case 8: // 顺时针旋转 270 度
+				dx, dy = y, sw-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// resizeRGBA 按区域平均缩小图片到 w x h
+func resizeRGBA(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[off+c])
+					}
+					off += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			off := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// exifOrientation 读取 JPEG 中 EXIF 的方向值，不存在时为 1
+func exifOrientation(data []byte) int {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		// 标记之间可以有填充的 0xFF
+		if data[pos+1] == 0xff {
+			pos++
+			continue
+		}
+		marker := data[pos+1]
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 { // 没有长度字段的标记
+			pos += 2
+			continue
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xda || size < 2 || pos+2+size > len(data) { // 图像数据开始或长度错误
+			break
+		}
+		seg := data[pos+4 : pos+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		pos += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation 读取 TIFF 结构 IFD0 中的 Orientation (0x0112)
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for e := ifd + 2; e+12 <= len(tiff) && n > 0; e, n = e+12, n-1 {
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// decodeBMP 解码未压缩的 8、24、32 位 BMP
+func decodeBMP(data []byte) (image.Image, error) {
+	if len(data) < 54 || !bytes.HasPrefix(data, bmpByte) {
+		return nil, ErrUnsupportedImage
+	}
+	le := binary.LittleEndian
+	offset := int(le.Uint32(data[10:]))
+	headerSize := int(le.Uint32(data[14:]))
+	width := int(int32(le.Uint32(data[18:])))
+	height := int(int32(le.Uint32(data[22:])))
+	bpp := int(le.Uint16(data[28:]))
+	compression := le.Uint32(data[30:])
+	if width <= 0 || height == 0 || (compression != 0 && !(compression == 3 && bpp == 32)) {
+		return nil, fmt.Errorf("%w: compressed bmp", ErrUnsupportedImage)
+	}
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+
+	var palette []color.RGBA
+	if bpp == 8 {
+		colors := int(le.Uint32(data[46:]))
+		if colors == 0 {
+			colors = 256
+		}
+		for c, p := 0, 14+headerSize; c < colors && p+4 <= len(data); c, p = c+1, p+4 {
+			palette = append(palette, color.RGBA{data[p+2], data[p+1], data[p], 0xff})
+		}
+	} else if bpp != 24 && bpp != 32 {
+		return nil, fmt.Errorf("%w: %d-bit bmp", ErrUnsupportedImage, bpp)
+	}
+
+	stride := (width*bpp/8 + 3) &^ 3
+	if offset+stride*height > len(data) {
+		return nil, fmt.Errorf("%w: truncated bmp", ErrUnsupportedImage)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := data[offset+y*stride:]
+		dy := height - 1 - y
+		if topDown {
+			dy = y
+		}
+		for x := 0; x < width; x++ {
+			var c color.RGBA
+			switch bpp {
+			case 8:
+				if int(row[x]) < len(palette) {
+					c = palette[row[x]]
+				}
+			case 24:
+				c = color.RGBA{row[x*3+2], row[x*3+1], row[x*3], 0xff}
+			case 32:
+				c = color.RGBA{row[x*4+2], row[x*4+1], row[x*4], 0xff}
+			}
+			img.SetRGBA(x, dy, c)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,113 @@
+package docx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	// 4x2 的 PNG，左上角为红色
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	src.Set(0, 0, color.RGBA{0xff, 0, 0, 0xff})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	img, _ := ImageFromBytes(buf.Bytes())
+
+	rotated, err := img.Transform(ImageTransform{Rotate: 90})
+	if err != nil {
+		t.Fatalf("旋转失败: %v", err)
+	}
+	out, _ := png.Decode(bytes.NewReader(rotated.data))
+	if rotated.Width != 2 || rotated.Height != 4 || out.Bounds().Dx() != 2 {
+		t.Errorf("旋转 90 度后应交换宽高: %+v", rotated)
+	}
+	if r, _, _, _ := out.At(1, 0).RGBA(); r != 0xffff {
+		t.Error("顺时针旋转 90 度后左上角应移到右上角")
+	}
+
+	small, err := img.SetWidth(400).SetHeight(200).Transform(ImageTransform{MaxWidth: 2})
+	if err != nil {
+		t.Fatalf("缩放失败: %v", err)
+	}
+	cfg, _ := png.DecodeConfig(bytes.NewReader(small.data))
+	if cfg.Width != 2 || cfg.Height != 1 || small.Width != 400 || small.Height != 200 {
+		t.Errorf("应只缩小像素而保留显示尺寸: %+v %+v", cfg, small)
+	}
+	if same, _ := img.Transform(ImageTransform{MaxWidth: 10}); same.data == nil || &same.data[0] != &img.data[0] {
+		t.Error("无需处理时应原样返回")
+	}
+	if _, err = img.Transform(ImageTransform{Rotate: 45}); err == nil {
+		t.Error("旋转角度不是 90 的倍数时应返回错误")
+	}
+
+	// 2x1 的 24 位 BMP: 蓝、绿
+	bmp := make([]byte, 62)
+	copy(bmp, "BM")
+	bmp[10], bmp[14], bmp[18], bmp[22], bmp[26], bmp[28] = 54, 40, 2, 1, 1, 24
+	copy(bmp[54:], []byte{0xff, 0, 0, 0, 0xff, 0})
+	bmpImg, _ := ImageFromBytes(bmp)
+	converted, err := bmpImg.Transform(ImageTransform{})
+	if err != nil || converted.Type != "png" {
+		t.Fatalf("BMP 应转换为 PNG: %+v %v", converted, err)
+	}
+	out, _ = png.Decode(bytes.NewReader(converted.data))
+	if _, _, b, _ := out.At(0, 0).RGBA(); b != 0xffff {
+		t.Error("BMP 像素解码错误")
+	}
+	if _, g, _, _ := out.At(1, 0).RGBA(); g != 0xffff {
+		t.Error("BMP 像素解码错误")
+	}
+}
+
+func TestTransformExifOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// 在 SOI 之后插入 Orientation = 6 的 EXIF 段
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00")
+	seg := append([]byte{0xff, 0xe1, 0, byte(len(exif) + 2)}, exif...)
+	data := append(append(append([]byte{}, buf.Bytes()[:2]...), seg...), buf.Bytes()[2:]...)
+
+	if o := exifOrientation(data); o != 6 {
+		t.Fatalf("EXIF 方向读取错误: %d", o)
+	}
+	img, _ := ImageFromBytes(data)
+	oriented, err := img.Transform(ImageTransform{AutoOrient: true, Quality: 50})
+	if err != nil {
+		t.Fatalf("摆正失败: %v", err)
+	}
+	cfg, _ := jpeg.DecodeConfig(bytes.NewReader(oriented.data))
+	if oriented.Type != "jpeg" || cfg.Width != 2 || cfg.Height != 4 || oriented.Width != 2 || oriented.Height != 4 {
+		t.Errorf("应按 EXIF 方向旋转: %+v %+v", cfg, oriented)
+	}
+}
+
+func TestExifOrientationMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("00\xff0\x00\x01"),
+		[]byte("\xff\xd8\xff\xe1\x00\x00"),
+		[]byte("\xff\xd8\xff\xe1\xff\xff"),
+		[]byte("\xff\xd8\xff\xe1\x00\x08Exif\x00\x00"),
+	} {
+		if o := exifOrientation(data); o != 1 {
+			t.Errorf("格式错误时方向应为 1: %q %d", data, o)
+		}
+	}
+	// 标记前的填充字节应被跳过
+	exif := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x03\x00\x00")
+	data := append([]byte{0xff, 0xd8, 0xff, 0xff, 0xe1, 0, byte(len(exif) + 2)}, exif...)
+	if o := exifOrientation(data); o != 3 {
+		t.Errorf("应跳过填充字节: %d", o)
+	}
+	img := ImgValue{Type: "jpeg", data: []byte("\xff\xd8\xff\xe1\x00\x01")}
+	if _, err := img.Transform(ImageTransform{AutoOrient: true}); err == nil {
+		t.Error("无法解码的 JPEG 应返回错误")
+	}
+}